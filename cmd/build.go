@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
 	"github.com/gitpod-io/gitpod/run-gp/pkg/update"
 	"github.com/spf13/cobra"
 )
@@ -40,8 +41,12 @@ var buildCmd = &cobra.Command{
 		if cfg.WorkspaceLocation == "" {
 			cfg.WorkspaceLocation = cfg.CheckoutLocation
 		}
+		err = validateIDE(buildOpts.IDE)
+		if err != nil {
+			return err
+		}
 
-		runtime, err := getRuntime(rootOpts.Workdir)
+		rt, err := getRuntime(rootOpts.Workdir)
 		if err != nil {
 			return err
 		}
@@ -69,7 +74,9 @@ var buildCmd = &cobra.Command{
 			buildingPhase := log.StartPhase("[building]", "workspace image")
 			ref := args[0]
 			bldLog := log.Writer()
-			err = runtime.BuildImage(ctx, bldLog, ref, cfg)
+			err = rt.BuildImage(ctx, bldLog, ref, cfg, runtime.BuildOpts{
+				IDE: rootOpts.cfg.IDE(buildOpts.IDE),
+			})
 			if err != nil {
 				buildingPhase.Failure(err.Error())
 				return
@@ -90,6 +97,11 @@ var buildCmd = &cobra.Command{
 	},
 }
 
+var buildOpts struct {
+	IDE string
+}
+
 func init() {
 	rootCmd.AddCommand(buildCmd)
+	buildCmd.Flags().StringVar(&buildOpts.IDE, "ide", "code", "IDE to build into the image: code for VS Code, or an IDE defined in the run-gp config")
 }
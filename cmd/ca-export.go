@@ -0,0 +1,49 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/proxy"
+	"github.com/spf13/cobra"
+)
+
+var caExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "prints the local CA certificate so that it can be added to a trust store",
+	Long: `Prints the PEM encoded certificate of the local CA which issues the certificates
+used by "run-gp run --https". Add this certificate to your system or browser trust
+store to access workspaces over HTTPS without certificate warnings.
+
+The CA is created if it does not exist yet.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := proxy.DefaultCADir()
+		if err != nil {
+			return err
+		}
+		ca, err := proxy.LoadOrCreateCA(dir)
+		if err != nil {
+			return err
+		}
+
+		if caExportOpts.Output != "" {
+			return ioutil.WriteFile(caExportOpts.Output, ca.CertificatePEM(), 0644)
+		}
+		_, err = os.Stdout.Write(ca.CertificatePEM())
+		return err
+	},
+}
+
+var caExportOpts struct {
+	Output string
+}
+
+func init() {
+	caCmd.AddCommand(caExportCmd)
+	caExportCmd.Flags().StringVarP(&caExportOpts.Output, "output", "o", "", "write the certificate to this file instead of stdout")
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+var cacheLsCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "lists the cache volumes",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listVolumes(context.Background(), runtime.LabelCache, []volumeColumn{
+			{Header: "IMAGE", Value: func(v runtime.VolumeInfo) string { return v.Labels[runtime.LabelCacheImage] }},
+			{Header: "PATH", Value: func(v runtime.VolumeInfo) string { return v.Labels[runtime.LabelCachePath] }},
+			{Header: "REPOSITORY", Value: func(v runtime.VolumeInfo) string {
+				if r := v.Labels[runtime.LabelCacheRepository]; r != "" {
+					return r
+				}
+				return "(all)"
+			}},
+		})
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheLsCmd)
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune [volume...]",
+	Short: "removes cache volumes which are not in use",
+	Long: `Removes the given cache volumes, or all cache volumes if none are given.
+Caches which are used by a running workspace are kept.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return pruneVolumes(cmd, runtime.LabelCache, "cache", args, func(v runtime.VolumeInfo) bool {
+			return cachePruneOpts.Image == "" || v.Labels[runtime.LabelCacheImage] == cachePruneOpts.Image
+		})
+	},
+}
+
+var cachePruneOpts struct {
+	Image string
+}
+
+func init() {
+	cacheCmd.AddCommand(cachePruneCmd)
+	cachePruneCmd.Flags().StringVar(&cachePruneOpts.Image, "image", "", "only remove the caches of this base image (see run-gp cache ls)")
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "manages the cache volumes shared by workspaces",
+}
+
+// cacheDir is the cache at a container path
+type cacheDir struct {
+	Path string
+	// Repository is set for caches declared by the project. They're not shared with other repositories.
+	Repository string
+}
+
+// cacheDirs returns the caches configured in the run-gp config and the project config.
+// If both configure a path, the cache of the run-gp config wins.
+func cacheDirs(project *config.ProjectConfig, repository string) ([]cacheDir, error) {
+	var dirs []cacheDir
+	for _, p := range rootOpts.cfg.Caches {
+		dirs = append(dirs, cacheDir{Path: p})
+	}
+	if project != nil {
+		for _, p := range project.Caches {
+			dirs = append(dirs, cacheDir{Path: p, Repository: repository})
+		}
+	}
+
+	res := make([]cacheDir, 0, len(dirs))
+	seen := make(map[string]struct{}, len(dirs))
+	for _, d := range dirs {
+		p, err := runtime.CachePath(d.Path)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := seen[p]; exists {
+			continue
+		}
+		seen[p] = struct{}{}
+		d.Path = p
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// cachePaths returns the container paths of caches
+func cachePaths(dirs []cacheDir) []string {
+	res := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		res = append(res, d.Path)
+	}
+	return res
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+}
@@ -43,6 +43,15 @@ var debugUICmd = &cobra.Command{
 		p.Failure("no good reason")
 		w.Discard()
 
+		progress := console.Progress{ID: "debug", Name: "Progress", Total: 5}
+		for i := 0; i < progress.Total; i++ {
+			progress.Done, progress.Current = i, fmt.Sprintf("step %d", i+1)
+			lg.SetProgress(progress)
+			time.Sleep(200 * time.Millisecond)
+		}
+		progress.Done, progress.Current = progress.Total, ""
+		lg.SetProgress(progress)
+
 		time.Sleep(200 * time.Millisecond)
 
 		return nil
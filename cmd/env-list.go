@@ -0,0 +1,46 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/telemetry"
+	"github.com/spf13/cobra"
+)
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists the environment variables which apply to the working directory",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		owner, repo, _ := config.ParseRepository(telemetry.GetGitRemoteOriginURI(rootOpts.Workdir))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVALUE\tSCOPE")
+		for _, v := range rootOpts.cfg.Env {
+			if !envListOpts.All && !v.Matches(owner, repo) {
+				continue
+			}
+			if envOpts.RepositoryPattern != "" && v.RepositoryPattern != envOpts.RepositoryPattern {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", v.Name, v.Value, v.RepositoryPattern)
+		}
+		return w.Flush()
+	},
+}
+
+var envListOpts struct {
+	All bool
+}
+
+func init() {
+	envCmd.AddCommand(envListCmd)
+	envListCmd.Flags().BoolVar(&envListOpts.All, "all", false, "list the variables of all repositories")
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var envSetCmd = &cobra.Command{
+	Use:   "set <name=value> [name=value...]",
+	Short: "sets environment variables for workspaces",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pattern, err := envRepositoryPattern()
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			segs := strings.SplitN(arg, "=", 2)
+			if len(segs) != 2 || segs[0] == "" {
+				return fmt.Errorf("%s has no value (correct format is name=value)", arg)
+			}
+			rootOpts.cfg.SetEnv(config.EnvVar{
+				Name:              segs[0],
+				Value:             segs[1],
+				RepositoryPattern: pattern,
+			})
+		}
+		err = rootOpts.cfg.Write()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("set %d variable(s) for %s - they apply to workspaces started from now on\n", len(args), pattern)
+		return nil
+	},
+}
+
+func init() {
+	envCmd.AddCommand(envSetCmd)
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var envUnsetCmd = &cobra.Command{
+	Use:   "unset <name> [name...]",
+	Short: "removes environment variables",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pattern, err := envRepositoryPattern()
+		if err != nil {
+			return err
+		}
+		for _, name := range args {
+			if !rootOpts.cfg.UnsetEnv(name, pattern) {
+				return fmt.Errorf("%s is not set for %s", name, pattern)
+			}
+		}
+		return rootOpts.cfg.Write()
+	},
+}
+
+func init() {
+	envCmd.AddCommand(envUnsetCmd)
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/telemetry"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "manages the environment variables passed to workspaces",
+}
+
+var envOpts struct {
+	RepositoryPattern string
+}
+
+// envRepositoryPattern returns the repository pattern set using --scope, or the repository of the working directory
+func envRepositoryPattern() (string, error) {
+	if envOpts.RepositoryPattern != "" {
+		err := config.ValidateRepositoryPattern(envOpts.RepositoryPattern)
+		if err != nil {
+			return "", err
+		}
+		return envOpts.RepositoryPattern, nil
+	}
+	owner, repo, ok := config.ParseRepository(telemetry.GetGitRemoteOriginURI(rootOpts.Workdir))
+	if !ok {
+		return "", fmt.Errorf("cannot determine the repository of %s: use --scope to set the repositories the variables apply to", rootOpts.Workdir)
+	}
+	return owner + "/" + repo, nil
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.PersistentFlags().StringVar(&envOpts.RepositoryPattern, "scope", "", "repository pattern (owner/repo) the variables apply to, e.g. gitpod-io/* or */* (defaults to the repository of the working directory)")
+}
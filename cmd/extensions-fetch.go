@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var extensionsFetchCmd = &cobra.Command{
+	Use:   "fetch",
+	Short: "downloads the VS Code extensions of the .gitpod.yml into the extension cache",
+	Long: `Downloads the VS Code extensions listed in the .gitpod.yml and the .run-gp.yaml
+into the extension cache shared by all workspaces. Once the cache is populated, workspaces start
+without access to the extension registry.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getGitpodYaml()
+		if err != nil {
+			return err
+		}
+		project, err := config.ReadProjectConfig(rootOpts.Workdir)
+		if err != nil {
+			return err
+		}
+
+		var failed int
+		_, exts, err := fetchExtensions(context.Background(), listExtensions(cfg, project), cfg.CheckoutLocation, func(id string, err error) {
+			failed++
+			fmt.Fprintf(cmd.ErrOrStderr(), "cannot fetch %s: %v\n", id, err)
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range exts {
+			if !e.Cached {
+				continue
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\n", e.Extension, path.Base(e.File))
+		}
+		if failed > 0 {
+			return fmt.Errorf("cannot fetch %d extension(s)", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	extensionsCmd.AddCommand(extensionsFetchCmd)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/vsx"
+	"github.com/spf13/cobra"
+)
+
+var extensionsCmd = &cobra.Command{
+	Use:   "extensions",
+	Short: "manages the VS Code extension cache",
+}
+
+// listExtensions returns the VS Code extensions of the .gitpod.yml and the project config without duplicates
+func listExtensions(cfg *gitpod.GitpodConfig, project *config.ProjectConfig) []string {
+	var ids []string
+	if cfg.Vscode != nil {
+		ids = append(ids, cfg.Vscode.Extensions...)
+	}
+	if project != nil {
+		ids = append(ids, project.Extensions...)
+	}
+
+	res := make([]string, 0, len(ids))
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, exists := seen[id]; exists {
+			continue
+		}
+		seen[id] = struct{}{}
+		res = append(res, id)
+	}
+	return res
+}
+
+// workspaceExtension is a VS Code extension which is ready to be installed in the workspace
+type workspaceExtension struct {
+	Extension vsx.Extension
+	// File is the .vsix file in the workspace
+	File string
+	// Cached is true if the file is in the extension cache, as opposed to the working copy
+	Cached bool
+}
+
+// extensionFetchTimeout limits how long fetching a single extension may take
+const extensionFetchTimeout = 5 * time.Minute
+
+// fetchExtensions makes sure the extensions are available to the workspace. Extensions from the registry are fetched
+// into the extension cache, .vsix files must exist in the working copy which is mounted at checkoutLocation.
+// Extensions which are not available are reported to onFailure and skipped.
+func fetchExtensions(ctx context.Context, ids []string, checkoutLocation string, onFailure func(id string, err error)) (cacheDir string, exts []workspaceExtension, err error) {
+	cacheDir, err = vsx.DefaultCacheDir()
+	if err != nil {
+		return "", nil, err
+	}
+
+	reg := vsx.Registry{URL: rootOpts.cfg.Extensions.RegistryURL}
+	for _, id := range ids {
+		ext, err := vsx.Parse(id)
+		if err != nil {
+			onFailure(id, err)
+			continue
+		}
+
+		if ext.Path != "" {
+			_, err := os.Stat(filepath.Join(rootOpts.Workdir, filepath.FromSlash(ext.Path)))
+			if err != nil {
+				onFailure(id, err)
+				continue
+			}
+			exts = append(exts, workspaceExtension{
+				Extension: ext,
+				File:      path.Join("/workspace", checkoutLocation, ext.Path),
+			})
+			continue
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, extensionFetchTimeout)
+		fn, err := vsx.Fetch(fetchCtx, cacheDir, reg, ext)
+		cancel()
+		if err != nil {
+			onFailure(id, err)
+			continue
+		}
+		exts = append(exts, workspaceExtension{
+			Extension: ext,
+			File:      vsx.CachedFile(fn),
+			Cached:    true,
+		})
+	}
+	return cacheDir, exts, nil
+}
+
+func init() {
+	rootCmd.AddCommand(extensionsCmd)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/opener"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+// accessFile is where run records how to access the workspace, so that other run-gp invocations can find out.
+// It lives in the part of the state directory the workspace cannot access.
+const accessFile = "access.json"
+
+var openCmd = &cobra.Command{
+	Use:   "open [workspace]",
+	Short: "opens a running workspace in the browser, desktop VS Code or JetBrains Gateway",
+	Long: `Opens a running workspace in the browser, desktop VS Code or JetBrains Gateway.
+Set ` + opener.EnvOpenCommand + ` to override the command used to open URLs on this machine.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var n int
+		for _, v := range []bool{openOpts.Browser, openOpts.VSCode, openOpts.Gateway} {
+			if v {
+				n++
+			}
+		}
+		if n > 1 {
+			return fmt.Errorf("only one of --browser, --vscode and --gateway can be used")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, workspaceID, err := findRunningWorkspace(ctx, args)
+		if err != nil {
+			return err
+		}
+		stateDir, err := runtime.StateDir(workspaceID)
+		if err != nil {
+			return err
+		}
+		u, err := openURL(stateDir, workspaceID, openOpts)
+		if err != nil {
+			return err
+		}
+
+		return opener.Open(u)
+	},
+}
+
+type openOptions struct {
+	Browser bool
+	VSCode  bool
+	Gateway bool
+}
+
+var openOpts openOptions
+
+// openURL produces the URL which opens a workspace as requested, based on the access information run recorded
+func openURL(stateDir, workspaceID string, opts openOptions) (string, error) {
+	access, err := readWorkspaceAccess(stateDir)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case opts.VSCode:
+		if access.SSHHost == "" {
+			return "", fmt.Errorf("workspace %s has no SSH config entry - was it started with --no-ssh-config?", workspaceID)
+		}
+		return vscodeURL(access.SSHHost, access.WorkspaceFolder), nil
+	case opts.Gateway:
+		if access.GatewayURL == "" {
+			return "", fmt.Errorf("workspace %s has no JetBrains backend - start it using --ide with a JetBrains IDE", workspaceID)
+		}
+		return checkOpenURL(access.GatewayURL, "jetbrains-gateway")
+	default:
+		return checkOpenURL(access.URL, "http", "https")
+	}
+}
+
+// checkOpenURL makes sure we only hand URLs with the expected schemes to the host's URL handler,
+// which would run local files, for example
+func checkOpenURL(u string, schemes ...string) (string, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("invalid workspace URL %q: %w", u, err)
+	}
+	for _, s := range schemes {
+		if strings.EqualFold(pu.Scheme, s) {
+			return u, nil
+		}
+	}
+	return "", fmt.Errorf("refusing to open %q: expected a %s URL", u, strings.Join(schemes, " or "))
+}
+
+// vscodeURL produces a URI which makes desktop VS Code open a folder using Remote-SSH
+func vscodeURL(sshHost, folder string) string {
+	p := filepath.ToSlash(folder)
+	if filepath.Ext(p) == ".code-workspace" {
+		return "vscode://vscode-remote/ssh-remote+" + url.PathEscape(sshHost) + p + "?windowId=_blank"
+	}
+	return "vscode://vscode-remote/ssh-remote+" + url.PathEscape(sshHost) + p
+}
+
+func writeWorkspaceAccess(stateDir string, access console.WorkspaceAccess) error {
+	fc, err := json.Marshal(access)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(stateDir, 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(stateDir, accessFile), fc, 0600)
+}
+
+// removeWorkspaceAccess removes the access information of a workspace once it stops
+func removeWorkspaceAccess(stateDir string) {
+	err := os.Remove(filepath.Join(stateDir, accessFile))
+	if err != nil && !os.IsNotExist(err) {
+		console.Default.Warnf("cannot remove workspace access information: %v", err)
+	}
+}
+
+func readWorkspaceAccess(stateDir string) (*console.WorkspaceAccess, error) {
+	fc, err := ioutil.ReadFile(filepath.Join(stateDir, accessFile))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find out how to access the workspace: %w", err)
+	}
+	var res console.WorkspaceAccess
+	err = json.Unmarshal(fc, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func init() {
+	rootCmd.AddCommand(openCmd)
+	openCmd.Flags().BoolVar(&openOpts.Browser, "browser", false, "open the IDE in the browser (default)")
+	openCmd.Flags().BoolVar(&openOpts.VSCode, "vscode", false, "open the workspace folder in desktop VS Code using Remote-SSH")
+	openCmd.Flags().BoolVar(&openOpts.Gateway, "gateway", false, "connect JetBrains Gateway to the workspace")
+}
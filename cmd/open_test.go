@@ -0,0 +1,134 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+)
+
+func TestOpenURL(t *testing.T) {
+	access := console.WorkspaceAccess{
+		URL:             "https://workspace.localhost:8080/",
+		WorkspaceFolder: "/workspace/project",
+		SSHHost:         "rungp-workspace",
+		GatewayURL:      "jetbrains-gateway://connect#host=localhost",
+	}
+
+	tests := []struct {
+		Name        string
+		Access      *console.WorkspaceAccess
+		Opts        openOptions
+		Expectation string
+		Error       string
+	}{
+		{
+			Name:        "browser by default",
+			Access:      &access,
+			Expectation: "https://workspace.localhost:8080/",
+		},
+		{
+			Name:        "browser",
+			Access:      &access,
+			Opts:        openOptions{Browser: true},
+			Expectation: "https://workspace.localhost:8080/",
+		},
+		{
+			Name:        "vscode",
+			Access:      &access,
+			Opts:        openOptions{VSCode: true},
+			Expectation: "vscode://vscode-remote/ssh-remote+rungp-workspace/workspace/project",
+		},
+		{
+			Name:        "gateway",
+			Access:      &access,
+			Opts:        openOptions{Gateway: true},
+			Expectation: "jetbrains-gateway://connect#host=localhost",
+		},
+		{
+			Name:   "vscode without SSH config entry",
+			Access: &console.WorkspaceAccess{URL: access.URL},
+			Opts:   openOptions{VSCode: true},
+			Error:  "workspace ws has no SSH config entry",
+		},
+		{
+			Name:   "gateway without JetBrains backend",
+			Access: &console.WorkspaceAccess{URL: access.URL},
+			Opts:   openOptions{Gateway: true},
+			Error:  "workspace ws has no JetBrains backend",
+		},
+		{
+			Name:   "browser refuses other schemes",
+			Access: &console.WorkspaceAccess{URL: "file:///workspace/evil.command"},
+			Error:  `refusing to open "file:///workspace/evil.command": expected a http or https URL`,
+		},
+		{
+			Name:   "gateway refuses other schemes",
+			Access: &console.WorkspaceAccess{GatewayURL: "https://example.com/evil.jnlp"},
+			Opts:   openOptions{Gateway: true},
+			Error:  "expected a jetbrains-gateway URL",
+		},
+		{
+			Name:        "vscode URI is built locally",
+			Access:      &console.WorkspaceAccess{SSHHost: "evil host/..", WorkspaceFolder: "/workspace/project"},
+			Opts:        openOptions{VSCode: true},
+			Expectation: "vscode://vscode-remote/ssh-remote+evil%20host%2F../workspace/project",
+		},
+		{
+			Name:  "workspace not started by run",
+			Error: "cannot find out how to access the workspace",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			stateDir := t.TempDir()
+			if test.Access != nil {
+				err := writeWorkspaceAccess(stateDir, *test.Access)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			act, err := openURL(stateDir, "ws", test.Opts)
+			if test.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.Error) {
+					t.Fatalf("expected error containing %q, got %v", test.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if act != test.Expectation {
+				t.Errorf("unexpected URL: got %q, expected %q", act, test.Expectation)
+			}
+		})
+	}
+}
+
+func TestRemoveWorkspaceAccess(t *testing.T) {
+	stateDir := t.TempDir()
+	err := writeWorkspaceAccess(stateDir, console.WorkspaceAccess{URL: "https://workspace.localhost:8080/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removeWorkspaceAccess(stateDir)
+	if _, err := os.Stat(filepath.Join(stateDir, accessFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected access file to be removed, got %v", err)
+	}
+	// removing it again is fine, e.g. if the workspace never recorded its access information
+	removeWorkspaceAccess(stateDir)
+
+	_, err = openURL(stateDir, "ws", openOptions{})
+	if err == nil {
+		t.Fatal("expected open to fail once the workspace stopped")
+	}
+}
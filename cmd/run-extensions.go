@@ -0,0 +1,115 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/supervisor"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/vsx"
+)
+
+// provisionExtensions fetches the VS Code extensions into the extension cache and makes the cache available to the
+// workspace. Once the workspace content is available, the extensions are installed from the cache or the working copy,
+// so that they're available even if the registry is not.
+func provisionExtensions(ctx context.Context, log console.Log, rt runtime.Runtime, status *supervisor.Client, cfg *gitpod.GitpodConfig, ids []string, opts *runtime.StartOpts) {
+	if len(ids) == 0 {
+		return
+	}
+
+	phase := log.StartPhase("[fetching]", "VS Code extensions")
+	cacheDir, exts, err := fetchExtensions(ctx, ids, cfg.CheckoutLocation, func(id string, err error) {
+		log.Warnf("cannot fetch extension %s: %v", id, err)
+	})
+	if err != nil {
+		phase.Failure(err.Error())
+		return
+	}
+	phase.Success()
+	if len(exts) == 0 {
+		return
+	}
+
+	var cached bool
+	for _, e := range exts {
+		cached = cached || e.Cached
+	}
+	if cached {
+		opts.Mounts = append(opts.Mounts, runtime.Mount{
+			Source:   cacheDir,
+			Target:   vsx.CacheMount,
+			ReadOnly: true,
+		})
+	}
+
+	go func() {
+		err := supervisor.Retry(ctx, time.Second, func() error {
+			_, err := status.ContentStatus(ctx, true)
+			return err
+		})
+		if err != nil {
+			return
+		}
+
+		container := runtime.ContainerName(opts.WorkspaceID)
+		progress := console.Progress{ID: "extensions", Name: "Extensions", Total: len(exts)}
+		for _, e := range exts {
+			progress.Current = "installing " + e.Extension.String()
+			log.SetProgress(progress)
+
+			err := installExtension(ctx, log, rt, container, e)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Warnf("cannot install extension %s: %v", e.Extension, err)
+			}
+			progress.Done++
+		}
+		progress.Current = ""
+		log.SetProgress(progress)
+	}()
+}
+
+// extensionInstallTimeout limits how long installing a single extension may take
+const extensionInstallTimeout = 2 * time.Minute
+
+// installExtension installs an extension in a running workspace
+func installExtension(ctx context.Context, log console.Log, rt runtime.Runtime, container string, e workspaceExtension) error {
+	ctx, cancel := context.WithTimeout(ctx, extensionInstallTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	err := rt.Exec(ctx, container, vsx.InstallCommand(e.File), runtime.ExecOpts{
+		User:   "gitpod",
+		Stdout: &out,
+		Stderr: &out,
+	})
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", extensionInstallTimeout)
+	}
+	if err != nil {
+		log.Debugf("extension installation output: %s", out.String())
+		return fmt.Errorf("%s", installFailure(err, out.String()))
+	}
+	return nil
+}
+
+// installFailure describes why an extension could not be installed, preferring the last line VS Code printed
+func installFailure(err error, out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return last
+	}
+	return err.Error()
+}
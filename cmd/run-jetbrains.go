@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/jetbrains"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/supervisor"
+)
+
+// validateIDE makes sure the IDE selected using --ide is supported
+func validateIDE(ide string) error {
+	if custom := rootOpts.cfg.IDE(ide); custom != nil {
+		return custom.Validate()
+	}
+	if ide == "code" || jetbrains.IsProduct(ide) {
+		return nil
+	}
+
+	supported := []string{"code"}
+	for p := range jetbrains.Products {
+		supported = append(supported, p)
+	}
+	for _, c := range rootOpts.cfg.IDEs {
+		supported = append(supported, c.Name)
+	}
+	sort.Strings(supported[1:])
+	return fmt.Errorf("unsupported value for --ide: %s. Supported are %s", ide, strings.Join(supported, ", "))
+}
+
+// suggestJetBrains points out the JetBrains IDEs the .gitpod.yml configures, unless --ide selects an IDE.
+// Their backends are large downloads, hence we don't use them without being asked to.
+func suggestJetBrains(log console.Log, cfg *gitpod.GitpodConfig) {
+	products := jetbrains.ConfiguredProducts(cfg.JetBrains)
+	if len(products) == 0 {
+		return
+	}
+	log.Infof("this project is configured for %s: use --ide %s to connect using JetBrains Gateway", strings.Join(products, ", "), products[0])
+}
+
+// provisionJetBrains downloads the backend of a JetBrains IDE and adds it to the workspace. Once the workspace
+// content is available, the plugins configured in the .gitpod.yml are installed.
+// It returns a link which connects JetBrains Gateway to the workspace.
+func provisionJetBrains(ctx context.Context, log console.Log, rt runtime.Runtime, status *supervisor.Client, cfg *gitpod.GitpodConfig, opts *runtime.StartOpts) (gatewayURL string, err error) {
+	product := opts.IDEAlias
+
+	phase := log.StartPhase("[provisioning]", "JetBrains "+product+" backend")
+	cacheDir, err := jetbrains.DefaultCacheDir()
+	if err != nil {
+		phase.Failure(err.Error())
+		return "", err
+	}
+	backendDir, err := jetbrains.Provision(ctx, cacheDir, product)
+	if err != nil {
+		phase.Failure(err.Error())
+		return "", err
+	}
+	phase.Success()
+
+	opts.Mounts = append(opts.Mounts, runtime.Mount{
+		Source:   backendDir,
+		Target:   jetbrains.BackendMount,
+		ReadOnly: true,
+	})
+
+	projectPath := filepath.Join("/workspace", cfg.WorkspaceLocation)
+	if plugins := jetbrains.Plugins(cfg.JetBrains, product); len(plugins) > 0 {
+		go func() {
+			err := supervisor.Retry(ctx, time.Second, func() error {
+				_, err := status.ContentStatus(ctx, true)
+				return err
+			})
+			if err != nil {
+				return
+			}
+
+			var out bytes.Buffer
+			cmd := append([]string{filepath.Join(jetbrains.BackendMount, "bin", "remote-dev-server.sh"), "installPlugins", projectPath}, plugins...)
+			err = rt.Exec(ctx, runtime.ContainerName(opts.WorkspaceID), cmd, runtime.ExecOpts{
+				User:   "gitpod",
+				Stdout: &out,
+				Stderr: &out,
+			})
+			if err != nil {
+				log.Warnf("cannot install JetBrains plugins: %v", err)
+				log.Debugf("installPlugins output: %s", out.String())
+			}
+		}()
+	}
+
+	if opts.SSHPort <= 0 {
+		log.Warnf("JetBrains Gateway connects using SSH, which is disabled. Use --ssh-port to enable it.")
+		return "", nil
+	}
+	return jetbrains.GatewayURL(opts.SSHPort, projectPath), nil
+}
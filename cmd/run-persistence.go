@@ -0,0 +1,102 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/supervisor"
+)
+
+// persistWorkspaceData keeps the VS Code server data, and optionally the home directory, in named volumes so that
+// settings, extensions and global state survive workspace restarts. If configured, the VS Code user settings of this
+// machine are copied into workspaces which have no settings yet.
+func persistWorkspaceData(ctx context.Context, log console.Log, rt runtime.Runtime, status *supervisor.Client, cfg config.PersistenceConfig, opts *runtime.StartOpts) error {
+	var (
+		volumeScope string
+		persist     = true
+	)
+	switch cfg.Scope {
+	case "", config.PersistenceScopeWorkspace:
+		volumeScope = opts.WorkspaceID
+	case config.PersistenceScopeUser:
+		volumeScope = ""
+	case config.PersistenceScopeNone:
+		persist = false
+	default:
+		return fmt.Errorf("unsupported persistence scope %q: only %s, %s and %s are supported", cfg.Scope, config.PersistenceScopeWorkspace, config.PersistenceScopeUser, config.PersistenceScopeNone)
+	}
+	if persist {
+		opts.Volumes = append(opts.Volumes, runtime.WorkspaceVolume(volumeScope, "vscode-remote", runtime.IDEDataDir))
+		if cfg.Home {
+			opts.Volumes = append(opts.Volumes, runtime.WorkspaceVolume(volumeScope, "home", runtime.HomeDir))
+		}
+	}
+
+	if !cfg.SeedSettings {
+		return nil
+	}
+	fn, err := hostVSCodeSettings()
+	if err != nil {
+		return err
+	}
+	settings, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		log.Debugf("not seeding VS Code settings: %s does not exist", fn)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read VS Code settings: %w", err)
+	}
+
+	go func() {
+		err := supervisor.Retry(ctx, time.Second, func() error {
+			_, err := status.ContentStatus(ctx, true)
+			return err
+		})
+		if err != nil {
+			return
+		}
+
+		var out bytes.Buffer
+		err = rt.Exec(ctx, runtime.ContainerName(opts.WorkspaceID), []string{"sh", "-c", seedSettingsScript, "--", workspaceVSCodeSettings}, runtime.ExecOpts{
+			User:   "gitpod",
+			Stdin:  bytes.NewReader(settings),
+			Stdout: &out,
+			Stderr: &out,
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Warnf("cannot seed VS Code settings: %v", err)
+			log.Debugf("seeding output: %s", out.String())
+		}
+	}()
+	return nil
+}
+
+// workspaceVSCodeSettings is where VS Code keeps the user settings in the workspace
+var workspaceVSCodeSettings = path.Join(runtime.IDEDataDir, "data", "User", "settings.json")
+
+// seedSettingsScript writes stdin to $1 unless that file exists already
+const seedSettingsScript = `[ -e "$1" ] && exit 0
+mkdir -p "$(dirname "$1")" && cat > "$1"`
+
+// hostVSCodeSettings returns the location of the VS Code user settings on this machine
+func hostVSCodeSettings() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "Code", "User", "settings.json"), nil
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/proxy"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/sshconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// addSSHConfig adds a host alias for the workspace to the user's SSH config and returns it.
+// If SSH is not published on a host port, the alias connects using run-gp ssh-proxy.
+// Entries of workspaces which are no longer running are removed on the way.
+func addSSHConfig(ctx context.Context, rt runtime.Runtime, workspaceID string, sshPort int, identity *sshconfig.Identity) (alias string, err error) {
+	dir, err := sshconfig.DefaultDir()
+	if err != nil {
+		return "", err
+	}
+
+	err = sshconfig.Prune(dir, func(id string) bool {
+		if id == workspaceID {
+			return true
+		}
+		_, err := rt.PublishedPort(ctx, runtime.ContainerName(id), proxy.IDEPort)
+		return err == nil
+	})
+	if err != nil {
+		console.Default.Debugf("cannot prune SSH config: %v", err)
+	}
+
+	var identityFile string
+	if identity != nil {
+		identityFile = identity.File
+	}
+
+	entry := sshconfig.Entry{
+		WorkspaceID:  workspaceID,
+		Port:         sshPort,
+		IdentityFile: identityFile,
+	}
+	if sshPort <= 0 {
+		// SSH isn't published on a host port, hence we tunnel through the container runtime
+		entry.ProxyCommand, err = sshProxyCommand(workspaceID)
+		if err != nil {
+			return "", err
+		}
+	}
+	return sshconfig.Add(dir, entry)
+}
+
+// collectSSHKeys produces the authorized_keys of the workspace and the identity to connect with.
+// Unless --ssh-public-key-path is set, all keys of the user are authorized.
+func collectSSHKeys() (authorizedKeys []byte, identity *sshconfig.Identity, err error) {
+	fn := runOpts.SSHPublicKeyPath
+	if fn == "" {
+		dir, err := sshconfig.DefaultDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		return sshconfig.AuthorizedKeys(dir)
+	}
+
+	if strings.HasPrefix(fn, "~") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot find user home directory: %w", err)
+		}
+		fn = filepath.Join(home, strings.TrimPrefix(fn, "~"))
+	}
+	key, comment, err := sshconfig.ReadPublicKey(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+	authorizedKeys = bytes.TrimSpace(ssh.MarshalAuthorizedKey(key))
+	authorizedKeys = append(authorizedKeys, []byte(" "+comment+"\n")...)
+
+	identity = &sshconfig.Identity{}
+	if privateKeyFN := strings.TrimSuffix(fn, ".pub"); privateKeyFN != fn {
+		if _, err := os.Stat(privateKeyFN); err == nil {
+			identity.File = privateKeyFN
+		}
+	}
+	return authorizedKeys, identity, nil
+}
+
+// removeSSHConfig removes the host alias of the workspace from the user's SSH config
+func removeSSHConfig(workspaceID string) {
+	dir, err := sshconfig.DefaultDir()
+	if err != nil {
+		return
+	}
+	err = sshconfig.Remove(dir, workspaceID)
+	if err != nil {
+		console.Default.Warnf("cannot remove workspace from SSH config: %v", err)
+	}
+}
+
+// resetKnownHosts forgets the host key of the previous run of the workspace, which run-gp ssh relies on
+// regardless of whether the workspace is added to the user's SSH config
+func resetKnownHosts(workspaceID string) {
+	dir, err := sshconfig.DefaultDir()
+	if err != nil {
+		return
+	}
+	err = sshconfig.ResetKnownHosts(dir, workspaceID)
+	if err != nil {
+		console.Default.Warnf("cannot reset known hosts of the workspace: %v", err)
+	}
+}
@@ -7,14 +7,22 @@ package cmd
 import (
 	"context"
 	"errors"
-	"io/ioutil"
-	"os"
+	"fmt"
+	"net"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
+	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/bridge"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
 	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/jetbrains"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/opener"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/proxy"
 	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/state"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/supervisor"
 	"github.com/gitpod-io/gitpod/run-gp/pkg/telemetry"
 	"github.com/gitpod-io/gitpod/run-gp/pkg/update"
 	"github.com/spf13/cobra"
@@ -51,7 +59,15 @@ var runCmd = &cobra.Command{
 			cfg.WorkspaceLocation = cfg.CheckoutLocation
 		}
 
-		runtime, err := getRuntime(rootOpts.Workdir)
+		if !cmd.Flags().Changed("ide") {
+			suggestJetBrains(log, cfg)
+		}
+		err = validateIDE(runOpts.IDE)
+		if err != nil {
+			return err
+		}
+
+		rt, err := getRuntime(rootOpts.Workdir)
 		if err != nil {
 			return err
 		}
@@ -76,10 +92,102 @@ var runCmd = &cobra.Command{
 				}
 			}
 
+			// Secrets are resolved before anything else so that they're masked in all logs
+			owner, repo, _ := config.ParseRepository(telemetry.GetGitRemoteOriginURI(rootOpts.Workdir))
+			env, err := rootOpts.cfg.ResolveEnv(ctx, rootOpts.cfg.EnvFor(owner, repo))
+			if err != nil {
+				log.Warnf("cannot set up environment variables: %v", err)
+				return
+			}
+			project, err := config.ReadProjectConfig(rootOpts.Workdir)
+			if err != nil {
+				log.Warnf("cannot read project config: %v", err)
+				return
+			}
+			projectEnv, err := rootOpts.cfg.ResolveProjectEnv(ctx, project.Env, owner, repo)
+			if err != nil {
+				log.Warnf("cannot set up environment variables of %s: %v", config.ProjectConfigFile, err)
+				return
+			}
+			dotEnv, err := project.DotEnv(rootOpts.Workdir)
+			if err != nil {
+				log.Warnf("cannot read env files: %v", err)
+				return
+			}
+			err = project.Container.Validate(rootOpts.Workdir)
+			if err != nil {
+				log.Warnf("invalid container config in %s: %v", config.ProjectConfigFile, err)
+				return
+			}
+			allowedProfile := runOpts.SecurityProfile
+			if allowedProfile == "" {
+				allowedProfile = rootOpts.cfg.SecurityProfile
+			}
+			securityProfile, err := config.SecurityProfile(allowedProfile, project.SecurityProfile)
+			if err != nil {
+				log.Warnf("cannot start workspace: %v", err)
+				return
+			}
+			err = project.Container.ValidateProfile(rootOpts.Workdir, securityProfile, runOpts.AllowHostMounts)
+			if err != nil {
+				log.Warnf("invalid container config in %s: %v", config.ProjectConfigFile, err)
+				return
+			}
+			if project.SecurityProfile == config.SecurityProfilePrivileged {
+				log.Warnf("%s requests the privileged security profile: the workspace runs privileged and can control the Docker daemon, i.e. it has full access to this machine", config.ProjectConfigFile)
+			}
+			// The Docker daemon of the sidecar runs privileged, hence projects cannot enable it by themselves
+			allowDockerSidecar := runOpts.DockerSidecar || rootOpts.cfg.Docker.Sidecar || allowedProfile == config.SecurityProfilePrivileged
+			if project.Docker.Sidecar && !allowDockerSidecar {
+				log.Warnf("cannot start workspace: %s enables the Docker sidecar, which runs a privileged Docker daemon: use --docker-sidecar to run it anyway", config.ProjectConfigFile)
+				return
+			}
+			dockerSidecar := allowDockerSidecar && (runOpts.DockerSidecar || rootOpts.cfg.Docker.Sidecar || project.Docker.Sidecar)
+			if dockerSidecar && securityProfile == config.SecurityProfileStrict {
+				log.Warnf("the Docker sidecar is not supported with security profile %s", securityProfile)
+				return
+			}
+			if project.Docker.Sidecar {
+				log.Warnf("%s enables the Docker sidecar: containers started in the workspace can run privileged", config.ProjectConfigFile)
+			}
+			repository := owner + "/" + repo
+			if owner == "" {
+				// without a remote, the caches of the project belong to its working directory
+				repository = runtime.WorkspaceID(rootOpts.Workdir)
+			}
+			caches, err := cacheDirs(project, repository)
+			if err != nil {
+				log.Warnf("cannot set up caches: %v", err)
+				return
+			}
+			baseImage, err := runtime.BaseImage(rootOpts.Workdir, cfg)
+			if err != nil {
+				log.Warnf("cannot determine base image: %v", err)
+				return
+			}
+
+			var fileOwner *runtime.UserMapping
+			if runOpts.HandBackFiles || rootOpts.cfg.HandBackFiles || rootOpts.cfg.RemapUser {
+				fileOwner, err = runtime.HostUserMapping()
+				if err != nil {
+					log.Warnf("not handing files back to the host user: %v", err)
+				}
+			}
+
+			workspaceID := runtime.WorkspaceID(rootOpts.Workdir)
+			err = rt.ClaimContainerName(ctx, runtime.ContainerName(workspaceID))
+			if err != nil {
+				log.Warnf("cannot start workspace: %v", err)
+				return
+			}
+
 			buildingPhase := log.StartPhase("[building]", "workspace image")
-			ref := filepath.Join("workspace-image:latest")
+			ref := runtime.ImageName(workspaceID)
 			bldLog := log.Writer()
-			err = runtime.BuildImage(ctx, bldLog, ref, cfg)
+			err = rt.BuildImage(ctx, bldLog, ref, cfg, runtime.BuildOpts{
+				IDE:       rootOpts.cfg.IDE(runOpts.IDE),
+				CacheDirs: cachePaths(caches),
+			})
 			if err != nil {
 				buildingPhase.Failure(err.Error())
 				return
@@ -87,23 +195,40 @@ var runCmd = &cobra.Command{
 			bldLog.Discard()
 			buildingPhase.Success()
 
-			var (
-				publicSSHKey   string
-				publicSSHKeyFN = runOpts.SSHPublicKeyPath
-			)
-			if strings.HasPrefix(publicSSHKeyFN, "~") {
-				home, err := os.UserHomeDir()
+			publicSSHKeys, sshIdentity, err := collectSSHKeys()
+			if err != nil {
+				log.Warnf("cannot set up SSH keys: %v", err)
+			}
+			var sshIdentityDesc string
+			if sshIdentity != nil {
+				sshIdentityDesc = sshIdentity.String()
+			}
+
+			opts := runOpts.StartOpts
+			opts.WorkspaceID = workspaceID
+
+			scheme := "http"
+			if runOpts.HTTPS {
+				scheme = "https"
+			}
+			baseURL := fmt.Sprintf("%s://localhost:%d", scheme, opts.IDEPort)
+			switch {
+			case runOpts.ProxyPort > 0:
+				opts.PublishOnLoopback = true
+				opts.WorkspaceURL = proxy.WorkspaceURL(scheme, opts.WorkspaceID, runOpts.ProxyPort)
+				baseURL = opts.WorkspaceURL
+				err = serveWorkspaceProxy(ctx, rt)
 				if err != nil {
-					log.Warnf("cannot find user home directory: %v", err)
+					log.Warnf("cannot start workspace proxy: %v", err)
+					return
+				}
+			case runOpts.HTTPS:
+				opts.PublishOnLoopback = true
+				err = serveHTTPS(ctx, rt, runtime.ContainerName(opts.WorkspaceID), cfg)
+				if err != nil {
+					log.Warnf("cannot start HTTPS proxy: %v", err)
 					return
 				}
-				publicSSHKeyFN = filepath.Join(home, strings.TrimPrefix(publicSSHKeyFN, "~"))
-			}
-
-			if fc, err := ioutil.ReadFile(publicSSHKeyFN); err == nil {
-				publicSSHKey = string(fc)
-			} else if rootOpts.Verbose {
-				log.Warnf("cannot read public SSH key from %s: %v", publicSSHKeyFN, err)
 			}
 
 			recordFailure := func() {
@@ -111,18 +236,124 @@ var runCmd = &cobra.Command{
 					return
 				}
 
-				telemetry.RecordWorkspaceFailure(telemetry.GetGitRemoteOriginURI(rootOpts.Workdir), "running", runtime.Name())
+				telemetry.RecordWorkspaceFailure(telemetry.GetGitRemoteOriginURI(rootOpts.Workdir), "running", rt.Name())
+			}
+
+			container := runtime.ContainerName(opts.WorkspaceID)
+			status := supervisor.NewClient(proxy.CachedTarget(func(ctx context.Context) (string, error) {
+				return rt.PublishedPort(ctx, container, proxy.IDEPort)
+			}))
+			opts.IDEAlias = runOpts.IDE
+			var gatewayURL string
+			if rootOpts.cfg.IDE(opts.IDEAlias) == nil && jetbrains.IsProduct(opts.IDEAlias) {
+				gatewayURL, err = provisionJetBrains(ctx, log, rt, status, cfg, &opts)
+				if err != nil {
+					return
+				}
+			}
+			opts.VSXRegistryURL = rootOpts.cfg.Extensions.RegistryURL
+			if rootOpts.cfg.IDE(opts.IDEAlias) == nil && opts.IDEAlias == "code" {
+				provisionExtensions(ctx, log, rt, status, cfg, listExtensions(cfg, project), &opts)
+			}
+			err = persistWorkspaceData(ctx, log, rt, status, rootOpts.cfg.Persistence, &opts)
+			if err != nil {
+				log.Warnf("cannot persist workspace data: %v", err)
+			}
+			for _, c := range caches {
+				opts.Volumes = append(opts.Volumes, runtime.CacheVolume(baseImage, c.Repository, c.Path))
+			}
+			opts.Container = project.Container
+			opts.SecurityProfile = securityProfile
+			opts.FileOwner = fileOwner
+			if dockerSidecar {
+				opts.DockerSidecar = &runtime.DockerSidecar{
+					Image: dockerSidecarImage(log, project, securityProfile),
+					GID:   runtime.GitpodGID,
+				}
 			}
 
-			runLogs := console.Observe(log, console.WorkspaceAccessInfo{
+			resetKnownHosts(opts.WorkspaceID)
+			var sshHost string
+			if !runOpts.NoSSHConfig {
+				sshHost, err = addSSHConfig(ctx, rt, opts.WorkspaceID, opts.SSHPort, sshIdentity)
+				if err != nil {
+					log.Warnf("cannot add workspace to SSH config: %v", err)
+				} else {
+					defer removeSSHConfig(opts.WorkspaceID)
+				}
+			}
+
+			stateDir, err := runtime.StateDir(opts.WorkspaceID)
+			if err != nil {
+				log.Warnf("cannot determine workspace state directory: %v", err)
+				return
+			}
+			err = state.Prepare(stateDir)
+			if err != nil {
+				log.Warnf("cannot prepare workspace state directory: %v", err)
+				return
+			}
+			urls := state.URLs{Workspace: baseURL}
+			if runOpts.ProxyPort > 0 {
+				urls.PortTemplate = proxy.PortURLTemplate(scheme, opts.WorkspaceID, runOpts.ProxyPort)
+			} else if !opts.NoPortForwarding {
+				urls.Ports = make(map[int]string, len(cfg.Ports))
+				for _, p := range cfg.Ports {
+					urls.Ports[p.Port.(int)] = fmt.Sprintf("%s://localhost:%d", scheme, p.Port.(int)+opts.PortOffset)
+				}
+			}
+			err = state.WriteURLs(state.Shared(stateDir), urls)
+			if err != nil {
+				log.Warnf("cannot record workspace URLs - gp url will not work: %v", err)
+			}
+
+			tasks := console.WorkspaceTasks{
+				Progress: func(i int) (string, int, bool) {
+					return runtime.TaskProgress(stateDir, i)
+				},
+			}
+			for _, t := range cfg.Tasks {
+				var name string
+				if t != nil {
+					name = t.Name
+				}
+				tasks.Names = append(tasks.Names, name)
+			}
+
+			access := console.WorkspaceAccessInfo{
 				WorkspaceFolder: filepath.Join("/workspace", cfg.WorkspaceLocation),
-				HTTPPort:        runOpts.StartOpts.IDEPort,
+				BaseURL:         baseURL,
 				SSHPort:         runOpts.StartOpts.SSHPort,
-			}, recordFailure)
-			opts := runOpts.StartOpts
+				SSHHost:         sshHost,
+				SSHIdentity:     sshIdentityDesc,
+				GatewayURL:      gatewayURL,
+			}
+			err = writeWorkspaceAccess(stateDir, access.WorkspaceAccess())
+			if err != nil {
+				log.Warnf("cannot record workspace access - run-gp open will not work: %v", err)
+			} else {
+				defer removeWorkspaceAccess(stateDir)
+			}
+
+			// environment variables set using gp env are user variables, too
+			gpEnv, err := state.ReadEnv(stateDir)
+			if err != nil {
+				log.Warnf("cannot read environment variables set using gp env: %v", err)
+			}
+			opts.Env = mergeEnv(env, gpEnv, projectEnv, dotEnv)
+
+			opts.HostGateway, err = rt.HostGateway(ctx)
+			if err == nil {
+				opts.HostBridgeURL, opts.HostBridgeToken, err = serveHostBridge(ctx, log, stateDir, opts.HostGateway)
+			}
+			if err != nil {
+				log.Warnf("cannot start host bridge - the workspace will not be able to open URLs on this machine: %v", err)
+			}
+
+			runLogs := console.Observe(ctx, log, access, tasks, status, recordFailure)
 			opts.Logs = runLogs
-			opts.SSHPublicKey = publicSSHKey
-			err := runtime.StartWorkspace(ctx, ref, cfg, opts)
+			opts.SSHPublicKey = string(publicSSHKeys)
+			err = rt.StartWorkspace(ctx, ref, cfg, opts)
 			if err != nil {
 				return
 			}
@@ -142,8 +373,159 @@ var runCmd = &cobra.Command{
 }
 
 var runOpts struct {
-	StartOpts        runtime.StartOpts
-	SSHPublicKeyPath string
+	StartOpts          runtime.StartOpts
+	SSHPublicKeyPath   string
+	HTTPS              bool
+	ProxyPort          int
+	IDE                string
+	NoSSHConfig        bool
+	HandBackFiles      bool
+	SecurityProfile    string
+	DockerSidecar      bool
+	DockerSidecarImage string
+	AllowHostMounts    bool
+}
+
+// dockerSidecarImage returns the image of the Docker daemon of a workspace. The daemon runs privileged, hence the
+// image the project asks for is used with the privileged security profile only.
+func dockerSidecarImage(log console.Log, project *config.ProjectConfig, securityProfile string) string {
+	if runOpts.DockerSidecarImage != "" {
+		return runOpts.DockerSidecarImage
+	}
+	if project.Docker.Image != "" {
+		if securityProfile == config.SecurityProfilePrivileged {
+			return project.Docker.Image
+		}
+		log.Warnf("ignoring the Docker daemon image %s asks for: it is used with the privileged security profile only", config.ProjectConfigFile)
+	}
+	return rootOpts.cfg.Docker.Image
+}
+
+func loadCA() (*proxy.CA, error) {
+	caDir, err := proxy.DefaultCADir()
+	if err != nil {
+		return nil, err
+	}
+	return proxy.LoadOrCreateCA(caDir)
+}
+
+// serveWorkspaceProxy serves all workspaces and their ports on the proxy port.
+// The proxy port is shared with other run-gp instances.
+func serveWorkspaceProxy(ctx context.Context, rt runtime.Runtime) error {
+	listen := func(addr string) (net.Listener, error) {
+		return net.Listen("tcp", addr)
+	}
+	if runOpts.HTTPS {
+		ca, err := loadCA()
+		if err != nil {
+			return err
+		}
+		listen = func(addr string) (net.Listener, error) {
+			return proxy.ListenTLSWithCA(addr, ca)
+		}
+	}
+
+	go proxy.ServeRouter(ctx, fmt.Sprintf("127.0.0.1:%d", runOpts.ProxyPort), listen, func(ctx context.Context, workspaceID string, port int) (string, error) {
+		return rt.PublishedPort(ctx, runtime.ContainerName(workspaceID), port)
+	})
+	return nil
+}
+
+// serveHostBridge lets the workspace open URLs and show notifications on this machine, and keeps the
+// environment variables set using gp env
+func serveHostBridge(ctx context.Context, log console.Log, stateDir, host string) (url, token string, err error) {
+	token, err = bridge.NewToken()
+	if err != nil {
+		return "", "", err
+	}
+	l, port, err := bridge.Listen(host)
+	if err != nil {
+		return "", "", err
+	}
+	go func() {
+		err := bridge.Serve(ctx, l, token, &hostBridgeHandler{Log: log, stateDir: stateDir})
+		if err != nil {
+			log.Warnf("host bridge failed: %v", err)
+		}
+	}()
+	return fmt.Sprintf("http://%s:%d", bridge.Host, port), token, nil
+}
+
+type hostBridgeHandler struct {
+	console.Log
+
+	stateDir string
+	mu       sync.Mutex
+}
+
+func (*hostBridgeHandler) OpenURL(url string) error {
+	return opener.Open(url)
+}
+
+func (h *hostBridgeHandler) SetEnv(set map[string]string, unset []string) (map[string]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	env, err := state.ReadEnv(h.stateDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		return env, nil
+	}
+	for k, v := range set {
+		env[k] = v
+	}
+	for _, k := range unset {
+		delete(env, k)
+	}
+	err = state.WriteEnv(h.stateDir, env)
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// serveHTTPS starts TLS-terminating proxies for the IDE and all forwarded ports.
+// The certificates are issued by the local run-gp CA.
+func serveHTTPS(ctx context.Context, rt runtime.Runtime, container string, cfg *gitpod.GitpodConfig) error {
+	ca, err := loadCA()
+	if err != nil {
+		return err
+	}
+	cert, err := ca.Issue(proxy.LocalHosts())
+	if err != nil {
+		return err
+	}
+
+	ports := map[int]int{
+		runOpts.StartOpts.IDEPort: proxy.IDEPort,
+	}
+	if !runOpts.StartOpts.NoPortForwarding {
+		for _, p := range cfg.Ports {
+			ports[p.Port.(int)+runOpts.StartOpts.PortOffset] = p.Port.(int)
+		}
+	}
+
+	for hostPort, containerPort := range ports {
+		l, err := proxy.ListenTLS(fmt.Sprintf(":%d", hostPort), cert)
+		if err != nil {
+			return err
+		}
+
+		containerPort := containerPort
+		target := proxy.CachedTarget(func(ctx context.Context) (string, error) {
+			return rt.PublishedPort(ctx, container, containerPort)
+		})
+		go func() {
+			err := proxy.Serve(ctx, l, target)
+			if err != nil {
+				console.Default.Warnf("HTTPS proxy for port %d failed: %v", containerPort, err)
+			}
+		}()
+	}
+
+	return nil
 }
 
 func init() {
@@ -152,5 +534,27 @@ func init() {
 	runCmd.Flags().IntVar(&runOpts.StartOpts.PortOffset, "port-offset", 0, "shift exposed ports by this number")
 	runCmd.Flags().IntVar(&runOpts.StartOpts.IDEPort, "ide-port", 8080, "port to expose open vs code server")
 	runCmd.Flags().IntVar(&runOpts.StartOpts.SSHPort, "ssh-port", 8082, "port to expose SSH on (set to 0 to disable SSH)")
-	runCmd.Flags().StringVar(&runOpts.SSHPublicKeyPath, "ssh-public-key-path", "~/.ssh/id_rsa.pub", "path to the user's public SSH key")
+	runCmd.Flags().BoolVar(&runOpts.HTTPS, "https", false, "serve the IDE and all forwarded ports over HTTPS using certificates from the local run-gp CA (see \"run-gp ca export\")")
+	runCmd.Flags().IntVar(&runOpts.ProxyPort, "proxy-port", 0, "serve the workspace and its ports as <workspace>.localhost and <port>-<workspace>.localhost on this port, shared by all workspaces (0 disables the proxy)")
+	runCmd.Flags().StringVar(&runOpts.IDE, "ide", "code", "IDE to use: code for VS Code in the browser, a JetBrains IDE (e.g. intellij or goland) to connect to using JetBrains Gateway, or an IDE defined in the run-gp config")
+	runCmd.Flags().BoolVar(&runOpts.HandBackFiles, "hand-back-files", false, "give the files the workspace created in the working directory back to you when it stops, and those of a workspace which did not stop cleanly when it starts (Linux only). The workspace keeps running as the gitpod user.")
+	runCmd.Flags().BoolVar(&runOpts.HandBackFiles, "remap-user", false, "former name of --hand-back-files")
+	_ = runCmd.Flags().MarkDeprecated("remap-user", "use --hand-back-files instead")
+	runCmd.Flags().StringVar(&runOpts.SecurityProfile, "security-profile", "", "least restrictive security profile the workspace may use: strict, default or privileged (defaults to the run-gp config's profile). Projects can request a more restrictive one.")
+	runCmd.Flags().BoolVar(&runOpts.DockerSidecar, "docker-sidecar", false, "run a Docker daemon for the workspace in a separate container instead of sharing the host's")
+	runCmd.Flags().StringVar(&runOpts.DockerSidecarImage, "docker-sidecar-image", "", "image of the Docker daemon started by --docker-sidecar (defaults to docker.image in the run-gp config, or docker:dind)")
+	runCmd.Flags().BoolVar(&runOpts.AllowHostMounts, "allow-host-mounts", false, "let the project mount paths from outside the parent directory of the working directory, read-only")
+	runCmd.Flags().BoolVar(&runOpts.NoSSHConfig, "no-ssh-config", false, "do not add the workspace to the user's SSH config")
+	runCmd.Flags().StringVar(&runOpts.SSHPublicKeyPath, "ssh-public-key-path", "", "path to the public SSH key to authorize (defaults to all keys in ~/.ssh and the SSH agent)")
+}
+
+// mergeEnv merges environment variables, later ones take precedence
+func mergeEnv(envs ...map[string]string) map[string]string {
+	res := make(map[string]string)
+	for _, env := range envs {
+		for k, v := range env {
+			res[k] = v
+		}
+	}
+	return res
 }
@@ -0,0 +1,90 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/proxy"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/sshconfig"
+	"github.com/spf13/cobra"
+)
+
+// workspaceSSHPort is the port the SSH server of supervisor listens on in the workspace
+const workspaceSSHPort = 23001
+
+// sshTunnelScript connects stdin/stdout to the SSH server in the workspace using bash alone,
+// because we cannot rely on the workspace image to have nc or socat. Background commands read from
+// /dev/null unless stdin is redirected explicitly.
+var sshTunnelScript = fmt.Sprintf(`exec 3<>/dev/tcp/127.0.0.1/%d || exit 1
+cat <&0 >&3 &
+cat <&3
+kill $! 2>/dev/null
+exit 0`, workspaceSSHPort)
+
+var sshProxyCmd = &cobra.Command{
+	Use:   "ssh-proxy [workspace]",
+	Short: "connects stdin/stdout to the SSH server of a running workspace - for use as OpenSSH ProxyCommand",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		rt, workspaceID, err := findRunningWorkspace(ctx, args)
+		if err != nil {
+			return err
+		}
+
+		return rt.Exec(ctx, runtime.ContainerName(workspaceID), []string{"bash", "-c", sshTunnelScript}, runtime.ExecOpts{
+			User:   "gitpod",
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
+	},
+}
+
+// findRunningWorkspace resolves the workspace passed as argument, or the workspace of the working directory,
+// and makes sure it's running. The workspace can be referred to by its ID or its SSH host alias.
+func findRunningWorkspace(ctx context.Context, args []string) (rt runtime.Runtime, workspaceID string, err error) {
+	rt, err = getRuntime(rootOpts.Workdir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(args) > 0 {
+		workspaceID = strings.TrimSuffix(args[0], sshconfig.HostAlias(""))
+	} else {
+		workspaceID = runtime.WorkspaceID(rootOpts.Workdir)
+	}
+	if _, err := rt.PublishedPort(ctx, runtime.ContainerName(workspaceID), proxy.IDEPort); err != nil {
+		return nil, "", fmt.Errorf("workspace %s does not seem to be running: %w", workspaceID, err)
+	}
+	return rt, workspaceID, nil
+}
+
+// sshProxyCommand produces the OpenSSH ProxyCommand which connects to a workspace
+func sshProxyCommand(workspaceID string) (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(self, " \t") {
+		self = `"` + self + `"`
+	}
+	res := fmt.Sprintf("%s ssh-proxy %s", self, workspaceID)
+	if rootOpts.Runtime != "auto" {
+		res += " --runtime " + rootOpts.Runtime
+	}
+	return res, nil
+}
+
+func init() {
+	rootCmd.AddCommand(sshProxyCmd)
+}
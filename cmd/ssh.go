@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/sshconfig"
+	"github.com/spf13/cobra"
+)
+
+var sshCmd = &cobra.Command{
+	Use:   "ssh [workspace] [-- command...]",
+	Short: "connects to a running workspace using SSH",
+	Long: `Connects to a running workspace using SSH. The connection is tunneled through the container runtime,
+hence this works even if the workspace was started with --ssh-port 0.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var command []string
+		if n := cmd.ArgsLenAtDash(); n >= 0 {
+			args, command = args[:n], args[n:]
+		}
+		if len(args) > 1 {
+			return errors.New("accepts at most one workspace")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, workspaceID, err := findRunningWorkspace(ctx, args)
+		if err != nil {
+			return err
+		}
+		proxyCommand, err := sshProxyCommand(workspaceID)
+		if err != nil {
+			return err
+		}
+		dir, err := sshconfig.DefaultDir()
+		if err != nil {
+			return err
+		}
+		knownHosts := sshconfig.KnownHostsFile(dir, workspaceID)
+		err = os.MkdirAll(filepath.Dir(knownHosts), 0700)
+		if err != nil {
+			return err
+		}
+
+		sshArgs := []string{
+			"-o", "ProxyCommand=" + proxyCommand,
+			"-o", "UserKnownHostsFile=" + knownHosts,
+			"-o", "StrictHostKeyChecking=accept-new",
+			"-o", "HostKeyAlias=" + sshconfig.HostAlias(workspaceID),
+		}
+		// ssh tries the user's default keys, but does not know about the one run-gp generated
+		if fn := sshconfig.GeneratedKeyFile(dir); fileExists(fn) {
+			sshArgs = append(sshArgs, "-i", fn)
+		}
+		sshArgs = append(sshArgs, "-l", "gitpod", "localhost")
+		sshArgs = append(sshArgs, command...)
+
+		ssh := exec.Command("ssh", sshArgs...)
+		ssh.Stdin = os.Stdin
+		ssh.Stdout = os.Stdout
+		ssh.Stderr = os.Stderr
+		err = ssh.Run()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		return err
+	},
+}
+
+func fileExists(fn string) bool {
+	_, err := os.Stat(fn)
+	return err == nil
+}
+
+func init() {
+	rootCmd.AddCommand(sshCmd)
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// detachKey is Ctrl+]
+const detachKey = 0x1d
+
+var tasksAttachCmd = &cobra.Command{
+	Use:   "attach <name>",
+	Short: "attaches to the terminal of a task of a running workspace",
+	Long: `Attaches the host terminal to the terminal supervisor runs a task in.
+The task is identified by its name, as listed by "run-gp tasks list".
+
+Press Ctrl+] to detach. Detaching leaves the task running.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, status, tasks, err := listWorkspaceTasks(ctx)
+		if err != nil {
+			return err
+		}
+
+		var (
+			task  *workspaceTask
+			names []string
+		)
+		for i, t := range tasks {
+			names = append(names, t.Name)
+			if t.Name == args[0] || t.Status.ID == args[0] || t.Status.Terminal == args[0] {
+				task = &tasks[i]
+			}
+		}
+		if task == nil {
+			return fmt.Errorf("workspace has no task named %s - available tasks are: %s", args[0], strings.Join(names, ", "))
+		}
+		alias := task.Status.Terminal
+		if alias == "" {
+			return fmt.Errorf("task %s has no terminal yet", task.Name)
+		}
+
+		fd := int(os.Stdin.Fd())
+		if term.IsTerminal(fd) {
+			oldState, err := term.MakeRaw(fd)
+			if err != nil {
+				return err
+			}
+			defer term.Restore(fd, oldState)
+
+			// polling the size works on all platforms, unlike SIGWINCH
+			go func() {
+				var cols, rows int
+				for {
+					c, r, err := term.GetSize(fd)
+					if err == nil && (c != cols || r != rows) {
+						err = status.SetTerminalSize(ctx, alias, c, r)
+						if err == nil {
+							cols, rows = c, r
+						}
+					}
+
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(250 * time.Millisecond):
+					}
+				}
+			}()
+		}
+		fmt.Fprintf(os.Stderr, "attached to %s - press Ctrl+] to detach\r\n", task.Name)
+
+		done := make(chan error, 2)
+		go func() {
+			exitCode, err := status.ListenTerminal(ctx, alias, os.Stdout)
+			if err == nil {
+				fmt.Fprintf(os.Stderr, "\r\ntask %s exited with code %d\r\n", task.Name, exitCode)
+			}
+			done <- err
+		}()
+		go func() {
+			buf := make([]byte, 4096)
+			for {
+				n, err := os.Stdin.Read(buf)
+				if err == io.EOF {
+					// keep showing the output, e.g. when stdin is not a terminal
+					return
+				}
+				if err != nil {
+					done <- err
+					return
+				}
+
+				data := buf[:n]
+				detach := bytes.IndexByte(data, detachKey)
+				if detach >= 0 {
+					data = data[:detach]
+				}
+				if len(data) > 0 {
+					err = status.WriteTerminal(ctx, alias, data)
+					if err != nil {
+						done <- err
+						return
+					}
+				}
+				if detach >= 0 {
+					fmt.Fprintf(os.Stderr, "\r\ndetached from %s\r\n", task.Name)
+					done <- nil
+					return
+				}
+			}
+		}()
+
+		return <-done
+	},
+}
+
+func init() {
+	tasksCmd.AddCommand(tasksAttachCmd)
+}
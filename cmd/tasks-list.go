@@ -0,0 +1,45 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+var tasksListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists the tasks of a running workspace",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		workspaceID, _, tasks, err := listWorkspaceTasks(context.Background())
+		if err != nil {
+			return err
+		}
+		stateDir, err := runtime.StateDir(workspaceID)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSTATE\tTERMINAL")
+		for _, t := range tasks {
+			phase, exitCode, exited := runtime.TaskProgress(stateDir, t.Index)
+			state, _ := console.DescribeTaskState(t.Status.State, phase, exitCode, exited)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", t.Name, state, t.Status.Terminal)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	tasksCmd.AddCommand(tasksListCmd)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/proxy"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/supervisor"
+	"github.com/spf13/cobra"
+)
+
+var tasksCmd = &cobra.Command{
+	Use:   "tasks",
+	Short: "interacts with the tasks of a running workspace",
+}
+
+var tasksOpts struct {
+	Workspace string
+}
+
+// workspaceTask is a task of a running workspace
+type workspaceTask struct {
+	Index  int
+	Name   string
+	Status supervisor.TaskStatus
+}
+
+// listWorkspaceTasks connects to the supervisor of a running workspace and lists its tasks
+func listWorkspaceTasks(ctx context.Context) (workspaceID string, status *supervisor.Client, tasks []workspaceTask, err error) {
+	rt, err := getRuntime(rootOpts.Workdir)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	workspaceID = tasksOpts.Workspace
+	if workspaceID == "" {
+		workspaceID = runtime.WorkspaceID(rootOpts.Workdir)
+	}
+	container := runtime.ContainerName(workspaceID)
+	if _, err := rt.PublishedPort(ctx, container, proxy.IDEPort); err != nil {
+		return "", nil, nil, fmt.Errorf("workspace %s does not seem to be running: %w", workspaceID, err)
+	}
+	status = supervisor.NewClient(proxy.CachedTarget(func(ctx context.Context) (string, error) {
+		return rt.PublishedPort(ctx, container, proxy.IDEPort)
+	}))
+
+	ts, err := status.Tasks(ctx)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("cannot list tasks: %w", err)
+	}
+
+	// The workspace might have been started from a different .gitpod.yml, hence we prefer
+	// the names supervisor knows about.
+	cfg, _ := getGitpodYaml()
+	for i, t := range ts {
+		idx, err := strconv.Atoi(t.ID)
+		if err != nil {
+			idx = i
+		}
+		name := t.Presentation.Name
+		if name == "" && cfg != nil && idx < len(cfg.Tasks) && cfg.Tasks[idx] != nil {
+			name = cfg.Tasks[idx].Name
+		}
+		if name == "" {
+			name = fmt.Sprintf("task-%d", idx+1)
+		}
+		tasks = append(tasks, workspaceTask{Index: idx, Name: name, Status: t})
+	}
+	return workspaceID, status, tasks, nil
+}
+
+func init() {
+	rootCmd.AddCommand(tasksCmd)
+	tasksCmd.PersistentFlags().StringVar(&tasksOpts.Workspace, "workspace", "", "ID of the workspace (defaults to the workspace of the working directory)")
+}
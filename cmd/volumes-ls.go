@@ -0,0 +1,34 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+var volumesLsCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "lists the volumes which keep workspace data",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listVolumes(context.Background(), runtime.LabelVolume, []volumeColumn{
+			{Header: "WORKSPACE", Value: func(v runtime.VolumeInfo) string {
+				if ws := v.Labels[runtime.LabelWorkspaceID]; ws != "" {
+					return ws
+				}
+				return "(all)"
+			}},
+			{Header: "PURPOSE", Value: func(v runtime.VolumeInfo) string { return v.Labels[runtime.LabelVolume] }},
+		})
+	},
+}
+
+func init() {
+	volumesCmd.AddCommand(volumesLsCmd)
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+var volumesPruneCmd = &cobra.Command{
+	Use:   "prune [volume...]",
+	Short: "removes workspace data volumes which are not in use",
+	Long: `Removes the given workspace data volumes, the volumes of a workspace using --workspace,
+or the volumes of all workspaces using --all. They hold settings, the home directory and Docker
+storage of workspaces, which are lost. Volumes which are used by a running workspace are kept.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && volumesPruneOpts.Workspace == "" && !volumesPruneOpts.All {
+			return fmt.Errorf("use --all to remove the volumes of all workspaces, or name the volumes or --workspace to remove")
+		}
+		return pruneVolumes(cmd, runtime.LabelVolume, "workspace data", args, func(v runtime.VolumeInfo) bool {
+			return volumesPruneOpts.Workspace == "" || v.Labels[runtime.LabelWorkspaceID] == volumesPruneOpts.Workspace
+		})
+	},
+}
+
+var volumesPruneOpts struct {
+	Workspace string
+	All       bool
+}
+
+func init() {
+	volumesCmd.AddCommand(volumesPruneCmd)
+	volumesPruneCmd.Flags().StringVar(&volumesPruneOpts.Workspace, "workspace", "", "only remove the volumes of this workspace (see run-gp volumes ls)")
+	volumesPruneCmd.Flags().BoolVar(&volumesPruneOpts.All, "all", false, "remove the volumes of all workspaces")
+}
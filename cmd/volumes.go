@@ -0,0 +1,118 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+var volumesCmd = &cobra.Command{
+	Use:   "volumes",
+	Short: "manages the volumes which keep workspace data across restarts",
+}
+
+// volumeColumn is a column of the table listVolumes prints
+type volumeColumn struct {
+	Header string
+	Value  func(v runtime.VolumeInfo) string
+}
+
+// listVolumes prints the volumes which carry a label as a table. The first column is the volume name.
+// The rows are sorted by the other columns, then by name.
+func listVolumes(ctx context.Context, label string, columns []volumeColumn) error {
+	rt, err := getRuntime(rootOpts.Workdir)
+	if err != nil {
+		return err
+	}
+	vols, err := rt.ListVolumes(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	columns = append([]volumeColumn{{Header: "NAME", Value: func(v runtime.VolumeInfo) string { return v.Name }}}, columns...)
+	columns = append(columns, volumeColumn{Header: "CREATED", Value: func(v runtime.VolumeInfo) string { return v.CreatedAt }})
+	rows := make([][]string, 0, len(vols))
+	for _, v := range vols {
+		row := make([]string, 0, len(columns))
+		for _, c := range columns {
+			row = append(row, c.Value(v))
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		for c := 1; c < len(columns); c++ {
+			if rows[i][c] != rows[j][c] {
+				return rows[i][c] < rows[j][c]
+			}
+		}
+		return rows[i][0] < rows[j][0]
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	headers := make([]string, 0, len(columns))
+	for _, c := range columns {
+		headers = append(headers, c.Header)
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// pruneVolumes removes the volumes which carry a label and match the filter. If names are given, only those
+// volumes are removed and each of them must exist. Volumes which are used by a running workspace are kept.
+func pruneVolumes(cmd *cobra.Command, label, kind string, names []string, filter func(v runtime.VolumeInfo) bool) error {
+	ctx := context.Background()
+	rt, err := getRuntime(rootOpts.Workdir)
+	if err != nil {
+		return err
+	}
+	vols, err := rt.ListVolumes(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = false
+	}
+	for _, v := range vols {
+		if len(names) > 0 {
+			if _, ok := selected[v.Name]; !ok {
+				continue
+			}
+			selected[v.Name] = true
+		}
+		if !filter(v) {
+			continue
+		}
+
+		err := rt.RemoveVolume(ctx, v.Name)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "skipping %s: %v\n", v.Name, err)
+			continue
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), v.Name)
+	}
+	for name, found := range selected {
+		if !found {
+			return fmt.Errorf("%s is not a %s volume", name, kind)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(volumesCmd)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/bridge"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env [NAME=VALUE ...]",
+	Short: "Controls the environment variables of this workspace",
+	Long: `Controls the environment variables of this workspace. Without arguments, gp env prints
+the variables set so far. The variables are passed to the workspace whenever it (re)starts.
+To use them in the current shell, run: eval $(gp env -e)`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var req bridge.EnvRequest
+		for _, arg := range args {
+			segs := strings.SplitN(arg, "=", 2)
+			if len(segs) != 2 || segs[0] == "" {
+				return fmt.Errorf("%s has no value (correct format is name=value)", arg)
+			}
+			if req.Set == nil {
+				req.Set = make(map[string]string)
+			}
+			req.Set[segs[0]] = segs[1]
+		}
+		req.Unset = envOpts.Unset
+
+		// run-gp keeps the variables on the host, where only the user can access them
+		client, err := bridge.ClientFromEnv()
+		if err != nil {
+			return err
+		}
+		env, err := client.Env(context.Background(), req)
+		if err != nil {
+			return err
+		}
+		if (len(req.Set) > 0 || len(req.Unset) > 0) && !envOpts.Export {
+			return nil
+		}
+
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if envOpts.Export {
+				fmt.Printf("export %s=%s\n", name, shellQuote(env[name]))
+			} else {
+				fmt.Printf("%s=%s\n", name, env[name])
+			}
+		}
+		for _, name := range envOpts.Unset {
+			if envOpts.Export {
+				fmt.Printf("unset %s\n", name)
+			}
+		}
+		return nil
+	},
+}
+
+var envOpts struct {
+	Export bool
+	Unset  []string
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.Flags().BoolVarP(&envOpts.Export, "export", "e", false, "print the variables as shell export statements")
+	envCmd.Flags().StringArrayVarP(&envOpts.Unset, "unset", "u", nil, "unset an environment variable")
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/bridge"
+	"github.com/spf13/cobra"
+)
+
+var openCmd = &cobra.Command{
+	Use:   "open <file|url>",
+	Short: "Opens a file in the IDE, or a URL in the browser of the host",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if strings.HasPrefix(args[0], "http://") || strings.HasPrefix(args[0], "https://") {
+			return openOnHost(args[0])
+		}
+
+		editor := os.Getenv("GP_OPEN_EDITOR")
+		if editor == "" {
+			return fmt.Errorf("cannot open %s: no IDE is connected (GP_OPEN_EDITOR is not set)", args[0])
+		}
+		command := strings.Fields(editor)
+		c := exec.Command(command[0], append(command[1:], args[0])...)
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		return c.Run()
+	},
+}
+
+func openOnHost(url string) error {
+	client, err := bridge.ClientFromEnv()
+	if err != nil {
+		return err
+	}
+	return client.OpenURL(context.Background(), url)
+}
+
+func init() {
+	rootCmd.AddCommand(openCmd)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var portsAwaitCmd = &cobra.Command{
+	Use:   "await <port>",
+	Short: "Waits for a process to listen on a port",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		port, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil {
+			return fmt.Errorf("port cannot be parsed as int: %w", err)
+		}
+
+		for {
+			if isListening(int(port)) {
+				fmt.Printf("Port %d is now open.\n", port)
+				return nil
+			}
+			time.Sleep(time.Second)
+		}
+	},
+}
+
+// isListening checks if a process listens on a port on any address, like Gitpod's gp does.
+// Servers bound to the container IP only are not reachable on the loopback addresses.
+func isListening(port int) bool {
+	for _, fn := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		fc, err := ioutil.ReadFile(fn)
+		if err != nil {
+			continue
+		}
+		if listensOn(string(fc), port) {
+			return true
+		}
+	}
+	return false
+}
+
+// tcpListen is the state of listening sockets in /proc/net/tcp
+const tcpListen = "0A"
+
+// listensOn parses /proc/net/tcp{,6} and returns true if a socket listens on the port
+func listensOn(table string, port int) bool {
+	lines := strings.Split(table, "\n")
+	if len(lines) == 0 {
+		return false
+	}
+	// the first line is the header: sl local_address rem_address st ...
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[3] != tcpListen {
+			continue
+		}
+		idx := strings.LastIndex(fields[1], ":")
+		if idx < 0 {
+			continue
+		}
+		p, err := strconv.ParseUint(fields[1][idx+1:], 16, 16)
+		if err != nil {
+			continue
+		}
+		if int(p) == port {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	portsCmd.AddCommand(portsAwaitCmd)
+}
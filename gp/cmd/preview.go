@@ -0,0 +1,38 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/state"
+	"github.com/spf13/cobra"
+)
+
+var previewCmd = &cobra.Command{
+	Use:   "preview <url|port>",
+	Short: "Opens a URL, or the URL of a workspace port, in the browser of the host",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		url := args[0]
+		if port, err := strconv.ParseUint(url, 10, 16); err == nil {
+			urls, err := state.ReadURLs(state.Mount)
+			if err != nil {
+				return err
+			}
+			var ok bool
+			url, ok = urls.PortURL(int(port))
+			if !ok {
+				return fmt.Errorf("port %d is not forwarded", port)
+			}
+		}
+		return openOnHost(url)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(previewCmd)
+}
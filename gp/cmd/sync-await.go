@@ -0,0 +1,31 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var syncAwaitCmd = &cobra.Command{
+	Use:   "sync-await <name>",
+	Short: "Waits until gp sync-done <name> is called, e.g. by another task",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fn, err := syncMarker(args[0])
+		if err != nil {
+			return err
+		}
+		for !markerExists(fn) {
+			time.Sleep(time.Second)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncAwaitCmd)
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var syncDoneCmd = &cobra.Command{
+	Use:   "sync-done <name>",
+	Short: "Notifies gp sync-await <name> waiters that an event has happened",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fn, err := syncMarker(args[0])
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(syncDir, 0777)
+		if err != nil {
+			return err
+		}
+		// other users, e.g. root, might wait on the same markers
+		_ = os.Chmod(syncDir, 0777)
+		return os.WriteFile(fn, nil, 0644)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncDoneCmd)
+}
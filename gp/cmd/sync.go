@@ -0,0 +1,29 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// syncDir holds the sync markers. They are shared by all tasks and vanish when the workspace stops.
+const syncDir = "/tmp/gp-sync"
+
+var validSyncName = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+func syncMarker(name string) (string, error) {
+	if !validSyncName.MatchString(name) {
+		return "", fmt.Errorf("invalid name %q: only letters, digits, _, . and - are allowed", name)
+	}
+	return filepath.Join(syncDir, name+".done"), nil
+}
+
+func markerExists(fn string) bool {
+	_, err := os.Stat(fn)
+	return err == nil
+}
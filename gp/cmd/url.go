@@ -0,0 +1,44 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/state"
+	"github.com/spf13/cobra"
+)
+
+var urlCmd = &cobra.Command{
+	Use:   "url [port]",
+	Short: "Prints the URL of this workspace, or of one of its ports",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		urls, err := state.ReadURLs(state.Mount)
+		if err != nil {
+			return fmt.Errorf("cannot read the workspace URLs - is this a run-gp workspace? %w", err)
+		}
+		if len(args) == 0 {
+			fmt.Println(urls.Workspace)
+			return nil
+		}
+
+		port, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil {
+			return fmt.Errorf("port cannot be parsed as int: %w", err)
+		}
+		u, ok := urls.PortURL(int(port))
+		if !ok {
+			return fmt.Errorf("port %d is not forwarded - add it to the ports in the .gitpod.yml, or start run-gp using --proxy-port", port)
+		}
+		fmt.Println(u)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(urlCmd)
+}
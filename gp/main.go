@@ -0,0 +1,15 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+// gp is the run-gp implementation of the Gitpod CLI. It is installed in run-gp workspaces
+// and implements the gp commands against the local workspace state.
+package main
+
+import (
+	"github.com/gitpod-io/gitpod/run-gp/gp/cmd"
+)
+
+func main() {
+	cmd.Execute()
+}
@@ -12,6 +12,9 @@ SUPERVISOR="$(jq -r '.supervisor' "$base/pkg/runtime/assets/images.json")"
 WEBIDE="$(jq -r '."gitpod-code"' "$base/pkg/runtime/assets/images.json")"
 OPENVSCODE="$(jq -r '."open-vscode"' "$base/pkg/runtime/assets/images.json")"
 
+# gp is the run-gp implementation of the Gitpod CLI, see gp/
+(cd "$base" && CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -o "$tmpdir/gp" ./gp) || exit 1
+
 cat <<EOF > "$tmpdir/Dockerfile"
 FROM $SUPERVISOR AS supervisor
 FROM $WEBIDE AS webide
@@ -21,6 +24,7 @@ FROM alpine:3.16 AS staging
 
 RUN mkdir /staging
 COPY --from=supervisor /.supervisor /staging/supervisor/
+COPY gp /staging/gp/gp
 COPY --from=openvscode --chown=33333:33333 /home/.openvscode-server /staging/ide/
 COPY --from=webide --chown=33333:33333 /ide/startup.sh /ide/codehelper /staging/ide/
 COPY --from=webide --chown=33333:33333 /ide/extensions/gitpod-web /staging/ide/extensions/gitpod-web/
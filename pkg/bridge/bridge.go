@@ -0,0 +1,159 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// EnvRequest changes the environment variables set using gp env. Unset applies after Set.
+type EnvRequest struct {
+	Set   map[string]string `json:"set,omitempty"`
+	Unset []string          `json:"unset,omitempty"`
+}
+
+// Host is the name under which workspaces reach the host
+const Host = "host.docker.internal"
+
+// Handler acts on the requests of a workspace
+type Handler interface {
+	// OpenURL opens a URL on the host
+	OpenURL(url string) error
+	// Notify shows a notification to the user
+	Notify(message string)
+	// SetEnv changes the environment variables set using gp env and returns all of them
+	SetEnv(set map[string]string, unset []string) (map[string]string, error)
+}
+
+// NewToken produces a random token which authenticates the workspace with the bridge
+func NewToken() (string, error) {
+	var b [32]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Listen opens the listener of the bridge on a random port of a host address, or on loopback if the address
+// is empty. On Linux containers reach the host through the bridge network, hence the bridge must listen on the
+// gateway of that network. It must not listen on all interfaces though: all requests need to carry the token,
+// but that's no reason to expose the bridge to the local network.
+func Listen(host string) (l net.Listener, port int, err error) {
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	addr := net.JoinHostPort(host, "0")
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	return l, l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Serve serves the bridge API until the context is canceled
+func Serve(ctx context.Context, l net.Listener, token string, h Handler) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/open", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			URL string `json:"url"`
+		}
+		if !decode(w, r, &req) {
+			return
+		}
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			// opening anything but web pages could run arbitrary applications on the host
+			http.Error(w, "only http and https URLs can be opened", http.StatusBadRequest)
+			return
+		}
+		err = h.OpenURL(req.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+	mux.HandleFunc("/notify", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Message string `json:"message"`
+		}
+		if !decode(w, r, &req) {
+			return
+		}
+		if req.Message == "" {
+			http.Error(w, "message is empty", http.StatusBadRequest)
+			return
+		}
+		h.Notify(req.Message)
+	})
+	mux.HandleFunc("/env", func(w http.ResponseWriter, r *http.Request) {
+		var req EnvRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		for name := range req.Set {
+			if name == "" || strings.Contains(name, "=") {
+				http.Error(w, fmt.Sprintf("invalid name %q", name), http.StatusBadRequest)
+				return
+			}
+		}
+		env, err := h.SetEnv(req.Set, req.Unset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(env)
+	})
+
+	srv := &http.Server{
+		Handler:           authenticate(token, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	err := srv.Serve(l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func authenticate(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(dst)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
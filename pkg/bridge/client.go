@@ -0,0 +1,86 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// EnvURL tells the workspace where to reach the bridge
+	EnvURL = "RUNGP_BRIDGE_URL"
+	// EnvToken holds the token the workspace authenticates with
+	EnvToken = "RUNGP_BRIDGE_TOKEN"
+)
+
+// Client talks to the bridge from within the workspace
+type Client struct {
+	URL   string
+	Token string
+}
+
+// ClientFromEnv produces a client configured using the environment run-gp sets in the workspace
+func ClientFromEnv() (*Client, error) {
+	u, token := os.Getenv(EnvURL), os.Getenv(EnvToken)
+	if u == "" || token == "" {
+		return nil, fmt.Errorf("the host bridge is not available in this workspace")
+	}
+	return &Client{URL: strings.TrimSuffix(u, "/"), Token: token}, nil
+}
+
+// OpenURL asks the host to open a URL
+func (c *Client) OpenURL(ctx context.Context, url string) error {
+	return c.post(ctx, "/open", map[string]string{"url": url}, nil)
+}
+
+// Notify shows a notification in run-gp
+func (c *Client) Notify(ctx context.Context, message string) error {
+	return c.post(ctx, "/notify", map[string]string{"message": message}, nil)
+}
+
+// Env changes the environment variables set using gp env and returns all of them.
+// Without changes it just returns the variables.
+func (c *Client) Env(ctx context.Context, req EnvRequest) (map[string]string, error) {
+	var res map[string]string
+	err := c.post(ctx, "/env", req, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// post sends a request to the bridge and decodes the response into dst, if set
+func (c *Client) post(ctx context.Context, path string, body interface{}, dst interface{}) error {
+	fc, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+path, bytes.NewReader(fc))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("host bridge: %s", strings.TrimSpace(string(msg)))
+	}
+	if dst == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
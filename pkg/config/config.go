@@ -5,12 +5,14 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 
 	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
 	"github.com/vmware-labs/yaml-jsonpath/pkg/yamlpath"
@@ -24,17 +26,122 @@ type Config struct {
 	AutoUpdate AutoUpdateConfig `yaml:"autoUpdate"`
 
 	Telemetry TelemtryConfig `yaml:"telemetry"`
+
+	// IDEs are user-defined IDEs which can be selected using --ide
+	IDEs []IDEConfig `yaml:"ides,omitempty"`
+
+	// Env are environment variables passed to the workspaces of matching repositories
+	Env []EnvVar `yaml:"env,omitempty"`
+
+	Extensions ExtensionsConfig `yaml:"extensions,omitempty"`
+
+	Persistence PersistenceConfig `yaml:"persistence,omitempty"`
+
+	// SecurityProfile is strict, default or privileged. Projects can request a different profile.
+	SecurityProfile string `yaml:"securityProfile,omitempty"`
+
+	// Docker configures the Docker daemon of workspaces. Projects can enable the sidecar themselves.
+	Docker DockerConfig `yaml:"docker,omitempty"`
+
+	// HandBackFiles hands the files a workspace created in the working directory to the host user (Linux only).
+	// Processes in the workspace keep running as the gitpod user.
+	HandBackFiles bool `yaml:"handBackFiles,omitempty"`
+	// Deprecated: RemapUser is the former name of HandBackFiles
+	RemapUser bool `yaml:"remapUser,omitempty"`
+
+	// Caches are container paths, e.g. ~/.npm, which are kept in volumes shared by workspaces with the same base image
+	Caches []string `yaml:"caches,omitempty"`
+
+	// SecretProviders resolve secret references in environment variables, see SecretProvider
+	SecretProviders map[string]SecretProvider `yaml:"secretProviders,omitempty"`
 }
 
 type AutoUpdateConfig struct {
 	Enabled bool `yaml:"enabled"`
 }
 
+// ExtensionsConfig configures where VS Code extensions come from
+type ExtensionsConfig struct {
+	// RegistryURL points to an Open VSX compatible registry, e.g. an internal mirror. Defaults to https://open-vsx.org.
+	RegistryURL string `yaml:"registryURL,omitempty"`
+}
+
+// PersistenceConfig controls which workspace data outlives the workspace container
+type PersistenceConfig struct {
+	// Scope is workspace (the default) to keep the VS Code server data of each workspace in a named volume,
+	// user to share that volume between all workspaces, or none to discard the data when the workspace stops.
+	Scope string `yaml:"scope,omitempty"`
+	// Home keeps /home/gitpod in a named volume, too
+	Home bool `yaml:"home,omitempty"`
+	// SeedSettings copies the VS Code user settings of this machine into workspaces which have no settings yet
+	SeedSettings bool `yaml:"seedSettings,omitempty"`
+}
+
+const (
+	PersistenceScopeWorkspace = "workspace"
+	PersistenceScopeUser      = "user"
+	PersistenceScopeNone      = "none"
+)
+
 type TelemtryConfig struct {
 	Enabled  bool   `yaml:"enabled"`
 	Identity string `yaml:"identity"`
 }
 
+// IDEConfig defines an IDE which replaces the embedded VS Code in the workspace
+type IDEConfig struct {
+	Name string `yaml:"name"`
+
+	// Image is a container image which contains the IDE in Path
+	Image string `yaml:"image,omitempty"`
+	// Path is the directory in Image which contains the IDE. Defaults to /ide.
+	Path string `yaml:"path,omitempty"`
+	// Dir is a host directory which contains the IDE. Either Image or Dir must be set.
+	Dir string `yaml:"dir,omitempty"`
+
+	// Entrypoint starts the IDE. The IDE is available at /ide in the workspace.
+	Entrypoint string `yaml:"entrypoint"`
+	// Args are passed to the entrypoint. {IDEPORT} is replaced with the port the IDE must listen on.
+	Args []string `yaml:"args,omitempty"`
+
+	ReadinessCheck *IDEReadinessCheck `yaml:"readinessCheck,omitempty"`
+}
+
+// IDEReadinessCheck determines when an IDE is ready
+type IDEReadinessCheck struct {
+	// Type is either http or process
+	Type string `yaml:"type"`
+	// Path is requested on the IDE port for http checks
+	Path string `yaml:"path,omitempty"`
+}
+
+// Validate checks if the IDE config is complete
+func (c IDEConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("IDE has no name")
+	}
+	if (c.Image == "") == (c.Dir == "") {
+		return fmt.Errorf("IDE %s must have either an image or a dir", c.Name)
+	}
+	if c.Entrypoint == "" {
+		return fmt.Errorf("IDE %s has no entrypoint", c.Name)
+	}
+	if rc := c.ReadinessCheck; rc != nil && rc.Type != "http" && rc.Type != "process" {
+		return fmt.Errorf("IDE %s has an unsupported readiness check type %s: only http and process are supported", c.Name, rc.Type)
+	}
+	return nil
+}
+
+// IDE returns the user-defined IDE with the given name, or nil if there's none
+func (cfg *Config) IDE(name string) *IDEConfig {
+	for i, ide := range cfg.IDEs {
+		if ide.Name == name {
+			return &cfg.IDEs[i]
+		}
+	}
+	return nil
+}
+
 var paths = []func() (string, error){
 	func() (string, error) {
 		base, err := os.UserConfigDir()
@@ -118,7 +225,12 @@ func (cfg *Config) Write() error {
 	if err != nil && !os.IsExist(err) {
 		return err
 	}
-	err = ioutil.WriteFile(cfg.Filename, fc, 0644)
+	// the config may contain environment variables, hence only the user may read it
+	err = ioutil.WriteFile(cfg.Filename, fc, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(cfg.Filename, 0600)
 	if err != nil {
 		return err
 	}
@@ -148,23 +260,65 @@ func (cfg *Config) Set(path string, value string) error {
 	}
 	switch len(nds) {
 	case 0:
-		return fmt.Errorf("path %s unknown", path)
+		// empty fields are omitted, hence the path may well exist - the decoder tells us if it doesn't
+		err = addPath(&nd, path, value)
+		if err != nil {
+			return err
+		}
 	case 1:
+		nds[0].Value = value
 	default:
-		return fmt.Errorf("oath %s is not unique", path)
+		return fmt.Errorf("path %s is not unique", path)
 	}
 
-	nds[0].Value = value
-
 	fc, err = yaml.Marshal(&nd)
 	if err != nil {
 		return err
 	}
-	err = yaml.Unmarshal(fc, cfg)
+	var res Config
+	dec := yaml.NewDecoder(bytes.NewReader(fc))
+	dec.KnownFields(true)
+	err = dec.Decode(&res)
 	if err != nil {
-		return err
+		return fmt.Errorf("cannot set %s: %w", path, err)
+	}
+	res.Filename = cfg.Filename
+	*cfg = res
+
+	return nil
+}
+
+// addPath adds a dot-separated path with a scalar value to a YAML document
+func addPath(doc *yaml.Node, path, value string) error {
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
 	}
+	nd := doc.Content[0]
+	segs := strings.Split(path, ".")
+	for i, seg := range segs {
+		if seg == "" || strings.ContainsAny(seg, "$[]*'\"") {
+			return fmt.Errorf("path %s unknown", path)
+		}
+		if nd.Kind != yaml.MappingNode {
+			return fmt.Errorf("path %s unknown", path)
+		}
 
+		var child *yaml.Node
+		for j := 0; j+1 < len(nd.Content); j += 2 {
+			if nd.Content[j].Value == seg {
+				child = nd.Content[j+1]
+				break
+			}
+		}
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			if i == len(segs)-1 {
+				child = &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+			}
+			nd.Content = append(nd.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: seg}, child)
+		}
+		nd = child
+	}
 	return nil
 }
 
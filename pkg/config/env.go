@@ -0,0 +1,149 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// AllRepositories is the repository pattern which matches all workspaces
+const AllRepositories = "*/*"
+
+// EnvVar is an environment variable which is passed to workspaces whose repository matches the pattern
+type EnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+	// RepositoryPattern has the form owner/repo. Either part can be a glob, e.g. gitpod-io/* or */*.
+	RepositoryPattern string `yaml:"repositoryPattern"`
+}
+
+// Matches returns true if the variable applies to the repository.
+// Workspaces without repository only get the variables for all repositories.
+func (v EnvVar) Matches(owner, repo string) bool {
+	pattern := v.RepositoryPattern
+	if pattern == "" || pattern == "*" {
+		pattern = AllRepositories
+	}
+	if pattern == AllRepositories {
+		return true
+	}
+	if owner == "" || repo == "" {
+		return false
+	}
+
+	i := strings.LastIndex(pattern, "/")
+	if i < 0 {
+		return false
+	}
+	return matchSegment(pattern[:i], owner) && matchSegment(pattern[i+1:], repo)
+}
+
+// ValidateRepositoryPattern makes sure a repository pattern has the form owner/repo, see EnvVar.
+// The owner may contain slashes, e.g. for GitLab subgroups.
+func ValidateRepositoryPattern(pattern string) error {
+	i := strings.LastIndex(pattern, "/")
+	if i <= 0 || i == len(pattern)-1 {
+		return fmt.Errorf("invalid repository pattern %q: must have the form owner/repo, e.g. gitpod-io/* or */*", pattern)
+	}
+	for _, seg := range []string{pattern[:i], pattern[i+1:]} {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("invalid repository pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// specificity orders the patterns so that more specific ones take precedence
+func (v EnvVar) specificity() int {
+	var res int
+	for _, seg := range strings.Split(v.RepositoryPattern, "/") {
+		if seg != "*" && seg != "" {
+			res++
+		}
+	}
+	return res
+}
+
+func matchSegment(pattern, value string) bool {
+	if pattern == "*" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return ok
+}
+
+// EnvFor returns the environment variables which apply to a repository.
+// If several variables of the same name match, the one with the most specific pattern wins.
+func (cfg *Config) EnvFor(owner, repo string) map[string]string {
+	var (
+		res  = make(map[string]string)
+		spec = make(map[string]int)
+	)
+	for _, v := range cfg.Env {
+		if !v.Matches(owner, repo) {
+			continue
+		}
+		if s, ok := spec[v.Name]; ok && s > v.specificity() {
+			continue
+		}
+		res[v.Name] = v.Value
+		spec[v.Name] = v.specificity()
+	}
+	return res
+}
+
+// SetEnv adds or replaces an environment variable
+func (cfg *Config) SetEnv(v EnvVar) {
+	for i, e := range cfg.Env {
+		if e.Name == v.Name && e.RepositoryPattern == v.RepositoryPattern {
+			cfg.Env[i] = v
+			return
+		}
+	}
+	cfg.Env = append(cfg.Env, v)
+}
+
+// UnsetEnv removes an environment variable and returns true if it existed
+func (cfg *Config) UnsetEnv(name, repositoryPattern string) bool {
+	for i, e := range cfg.Env {
+		if e.Name == name && e.RepositoryPattern == repositoryPattern {
+			cfg.Env = append(cfg.Env[:i], cfg.Env[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+var scpLikeRemote = regexp.MustCompile(`^(?:[^@/]+@)?[^:/]+:(.+)$`)
+
+// ParseRepository extracts owner and repository from a git remote URI, e.g.
+// https://github.com/gitpod-io/run-gp.git or git@github.com:gitpod-io/run-gp.git.
+// Owners can contain slashes, e.g. GitLab subgroups.
+func ParseRepository(remote string) (owner, repo string, ok bool) {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return "", "", false
+	}
+
+	var p string
+	if u, err := url.Parse(remote); err == nil && u.Scheme != "" && u.Host != "" {
+		p = u.Path
+	} else if m := scpLikeRemote.FindStringSubmatch(remote); m != nil {
+		p = m[1]
+	} else {
+		return "", "", false
+	}
+
+	p = strings.Trim(strings.TrimSuffix(strings.Trim(p, "/"), ".git"), "/")
+	i := strings.LastIndex(p, "/")
+	if i <= 0 || i == len(p)-1 {
+		return "", "", false
+	}
+	return p[:i], p[i+1:], true
+}
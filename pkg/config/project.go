@@ -0,0 +1,354 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/dotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ProjectConfigFile configures run-gp for a project. It lives next to the .gitpod.yml.
+	ProjectConfigFile = ".run-gp.yaml"
+	// DefaultEnvFile is loaded if the project config does not list any env files
+	DefaultEnvFile = ".gitpod.env"
+)
+
+// ProjectConfig configures run-gp for a project, complementing the .gitpod.yml
+type ProjectConfig struct {
+	// Env are environment variables for the workspace. Values can reference secrets.
+	Env map[string]string `yaml:"env,omitempty"`
+	// EnvFiles are dotenv files relative to the working directory. Defaults to .gitpod.env if that exists.
+	EnvFiles []string `yaml:"envFiles,omitempty"`
+
+	// Extensions are VS Code extensions installed in addition to those in the .gitpod.yml,
+	// e.g. publisher.name@version pins or .vsix files relative to the working directory.
+	Extensions []string `yaml:"extensions,omitempty"`
+
+	// Caches are container paths which are kept in volumes shared by workspaces with the same base image
+	Caches []string `yaml:"caches,omitempty"`
+
+	// SecurityProfile requests a security profile (strict, default or privileged) for the workspace
+	SecurityProfile string `yaml:"securityProfile,omitempty"`
+
+	// Docker configures the Docker daemon of the workspace
+	Docker DockerConfig `yaml:"docker,omitempty"`
+
+	// Container adds mounts, devices, capabilities and runtime args to the workspace container
+	Container ContainerConfig `yaml:"container,omitempty"`
+}
+
+// ReadProjectConfig reads the project config in the working directory. It's fine for the file not to exist.
+func ReadProjectConfig(workdir string) (*ProjectConfig, error) {
+	fc, err := ioutil.ReadFile(filepath.Join(workdir, ProjectConfigFile))
+	if os.IsNotExist(err) {
+		return &ProjectConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var res ProjectConfig
+	err = yaml.Unmarshal(fc, &res)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", ProjectConfigFile, err)
+	}
+	return &res, nil
+}
+
+// DotEnv reads the dotenv files of the project. Later files take precedence.
+// The files must be inside the working directory, also once symlinks are resolved.
+func (p *ProjectConfig) DotEnv(workdir string) (map[string]string, error) {
+	files := p.EnvFiles
+	if len(files) == 0 {
+		if _, err := os.Stat(filepath.Join(workdir, DefaultEnvFile)); err != nil {
+			return nil, nil
+		}
+		files = []string{DefaultEnvFile}
+	}
+
+	root, err := filepath.EvalSymlinks(workdir)
+	if err != nil {
+		return nil, err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]string)
+	for _, name := range files {
+		fn := name
+		if !filepath.IsAbs(fn) {
+			fn = filepath.Join(workdir, fn)
+		}
+		fn, err := filepath.EvalSymlinks(fn)
+		if err != nil {
+			return nil, err
+		}
+		fn, err = filepath.Abs(fn)
+		if err != nil {
+			return nil, err
+		}
+		if !within(root, fn) {
+			return nil, fmt.Errorf("invalid env file %s: must be inside the working directory", name)
+		}
+
+		env, err := dotenv.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range env {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+// within returns true if fn is dir or inside of it. Both paths must be absolute and clean.
+func within(dir, fn string) bool {
+	rel, err := filepath.Rel(dir, fn)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// DockerConfig configures the Docker daemon available in a workspace
+type DockerConfig struct {
+	// Sidecar runs a Docker daemon for the workspace in a separate container instead of sharing the host's
+	Sidecar bool `yaml:"sidecar,omitempty"`
+	// Image of the Docker daemon, e.g. docker:24-dind. Defaults to docker:dind. The image a project sets is
+	// used with the privileged security profile only, because the daemon runs privileged.
+	Image string `yaml:"image,omitempty"`
+}
+
+// ContainerConfig adds to the container the workspace runs in
+type ContainerConfig struct {
+	Mounts []MountConfig `yaml:"mounts,omitempty"`
+	// Devices are host devices as path[:container path[:permissions]], e.g. /dev/kvm
+	Devices []string `yaml:"devices,omitempty"`
+	// Capabilities are added to the workspace container, e.g. SYS_PTRACE
+	Capabilities []string `yaml:"capabilities,omitempty"`
+	// Sysctls are namespaced kernel parameters, e.g. net.ipv4.ip_unprivileged_port_start
+	Sysctls map[string]string `yaml:"sysctls,omitempty"`
+	// Args are passed to the container runtime when starting the workspace, e.g. --shm-size=2g
+	Args []string `yaml:"args,omitempty"`
+	// RuntimeArgs are passed to a particular container runtime (docker or nerdctl) in addition to Args
+	RuntimeArgs map[string][]string `yaml:"runtimeArgs,omitempty"`
+}
+
+// MountConfig mounts a host path into the workspace
+type MountConfig struct {
+	// Source is the host path, relative to the working directory or starting with ~/
+	Source string `yaml:"source"`
+	// Target is the absolute path in the workspace
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"readOnly,omitempty"`
+}
+
+// SourcePath returns the absolute host path of the mount
+func (m MountConfig) SourcePath(workdir string) (string, error) {
+	src := m.Source
+	if src == "~" || strings.HasPrefix(src, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		src = filepath.Join(home, strings.TrimPrefix(src, "~"))
+	}
+	if !filepath.IsAbs(src) {
+		src = filepath.Join(workdir, src)
+	}
+	return filepath.Clean(src), nil
+}
+
+var (
+	capabilities = map[string]struct{}{
+		"AUDIT_CONTROL": {}, "AUDIT_READ": {}, "AUDIT_WRITE": {}, "BLOCK_SUSPEND": {}, "BPF": {}, "CHECKPOINT_RESTORE": {},
+		"CHOWN": {}, "DAC_OVERRIDE": {}, "DAC_READ_SEARCH": {}, "FOWNER": {}, "FSETID": {}, "IPC_LOCK": {}, "IPC_OWNER": {},
+		"KILL": {}, "LEASE": {}, "LINUX_IMMUTABLE": {}, "MAC_ADMIN": {}, "MAC_OVERRIDE": {}, "MKNOD": {}, "NET_ADMIN": {},
+		"NET_BIND_SERVICE": {}, "NET_BROADCAST": {}, "NET_RAW": {}, "PERFMON": {}, "SETFCAP": {}, "SETGID": {}, "SETPCAP": {},
+		"SETUID": {}, "SYS_ADMIN": {}, "SYS_BOOT": {}, "SYS_CHROOT": {}, "SYS_MODULE": {}, "SYS_NICE": {}, "SYS_PACCT": {},
+		"SYS_PTRACE": {}, "SYS_RAWIO": {}, "SYS_RESOURCE": {}, "SYS_TIME": {}, "SYS_TTY_CONFIG": {}, "SYSLOG": {}, "WAKE_ALARM": {},
+		"ALL": {},
+	}
+	// namespacedSysctls are the sysctl prefixes container runtimes accept
+	namespacedSysctls = []string{"kernel.msg", "kernel.sem", "kernel.shm", "fs.mqueue.", "net."}
+	sysctlName        = regexp.MustCompile(`^[a-z0-9_]+(\.[a-zA-Z0-9_-]+)+$`)
+	// runtimeFlags are the flags which can be passed to the container runtime, and whether they take a value.
+	// Flags which run-gp sets itself, e.g. --name, --label or --publish, are not supported.
+	runtimeFlags = map[string]bool{
+		"--add-host": true, "--blkio-weight": true, "--cap-add": true, "--cap-drop": true, "--cgroupns": true,
+		"--cpu-shares": true, "--cpus": true, "--cpuset-cpus": true, "--cpuset-mems": true, "--device": true,
+		"--device-cgroup-rule": true, "--dns": true, "--dns-option": true, "--dns-search": true, "--gpus": true,
+		"--group-add": true, "--hostname": true, "--ipc": true, "--memory": true, "--memory-reservation": true,
+		"--memory-swap": true, "--mount": true, "--oom-kill-disable": false, "--oom-score-adj": true, "--pid": true,
+		"--pids-limit": true, "--runtime": true, "--security-opt": true, "--shm-size": true, "--stop-timeout": true,
+		"--sysctl": true, "--tmpfs": true, "--ulimit": true, "--userns": true, "--uts": true, "--volume": true,
+	}
+	// runtimeFlagAliases maps the short flags to their long form
+	runtimeFlagAliases = map[string]string{
+		"-c": "--cpu-shares", "-h": "--hostname", "-m": "--memory", "-v": "--volume",
+	}
+)
+
+// Validate checks the container config. Mount sources and devices must exist.
+func (c ContainerConfig) Validate(workdir string) error {
+	for _, m := range c.Mounts {
+		if m.Source == "" || m.Target == "" {
+			return fmt.Errorf("mount %s:%s must have a source and a target", m.Source, m.Target)
+		}
+		src, err := m.SourcePath(workdir)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(src); err != nil {
+			return fmt.Errorf("cannot mount %s: %w", m.Source, err)
+		}
+		tgt := path.Clean(m.Target)
+		if !path.IsAbs(tgt) {
+			return fmt.Errorf("cannot mount %s: target %s is not absolute", m.Source, m.Target)
+		}
+		if tgt == "/" || tgt == "/workspace" || tgt == "/ide" || strings.HasPrefix(tgt, "/ide/") || strings.HasPrefix(tgt, "/.") {
+			return fmt.Errorf("cannot mount %s: target %s is reserved", m.Source, m.Target)
+		}
+	}
+	for _, d := range c.Devices {
+		host := strings.SplitN(d, ":", 2)[0]
+		if !strings.HasPrefix(host, "/dev/") {
+			return fmt.Errorf("invalid device %s: must be in /dev", d)
+		}
+		if segs := strings.Split(d, ":"); len(segs) == 3 && strings.Trim(segs[2], "rwm") != "" {
+			return fmt.Errorf("invalid device %s: permissions must be a combination of r, w and m", d)
+		} else if len(segs) > 3 {
+			return fmt.Errorf("invalid device %s: must be path[:container path[:permissions]]", d)
+		}
+		if _, err := os.Stat(host); err != nil {
+			return fmt.Errorf("invalid device %s: %w", d, err)
+		}
+	}
+	for _, capability := range c.Capabilities {
+		if _, ok := capabilities[strings.TrimPrefix(strings.ToUpper(capability), "CAP_")]; !ok {
+			return fmt.Errorf("unknown capability %s", capability)
+		}
+	}
+	for k := range c.Sysctls {
+		if !sysctlName.MatchString(k) {
+			return fmt.Errorf("invalid sysctl %s", k)
+		}
+		var namespaced bool
+		for _, p := range namespacedSysctls {
+			namespaced = namespaced || strings.HasPrefix(k, p)
+		}
+		if !namespaced {
+			return fmt.Errorf("sysctl %s is not namespaced and cannot be set for a container", k)
+		}
+	}
+	for rt := range c.RuntimeArgs {
+		if rt != "docker" && rt != "nerdctl" {
+			return fmt.Errorf("unsupported runtime %s in runtimeArgs: only docker and nerdctl are supported", rt)
+		}
+	}
+	_, err := c.runtimeArgs()
+	return err
+}
+
+// runtimeArg is a flag passed to the container runtime and its value, if it takes one
+type runtimeArg struct {
+	Name  string
+	Value string
+}
+
+// parseArgs makes sure the runtime args are supported flags and their values, and don't interfere with run-gp
+func parseArgs(args []string) ([]runtimeArg, error) {
+	var res []runtimeArg
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return nil, fmt.Errorf("invalid runtime arg %s: only flags are supported", arg)
+		}
+
+		segs := strings.SplitN(arg, "=", 2)
+		name := segs[0]
+		if long, ok := runtimeFlagAliases[name]; ok {
+			name = long
+		}
+		if name == "--privileged" {
+			return nil, fmt.Errorf("runtime arg %s is not supported: use securityProfile: %s instead", name, SecurityProfilePrivileged)
+		}
+		takesValue, ok := runtimeFlags[name]
+		if !ok {
+			return nil, fmt.Errorf("runtime arg %s is not supported", segs[0])
+		}
+
+		ra := runtimeArg{Name: name}
+		switch {
+		case len(segs) == 2:
+			ra.Value = segs[1]
+		case takesValue:
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("runtime arg %s requires a value", segs[0])
+			}
+			i++
+			ra.Value = args[i]
+		}
+		res = append(res, ra)
+	}
+	return res, nil
+}
+
+// nerdctlUnsupportedFlags are the runtime flags nerdctl does not have
+var nerdctlUnsupportedFlags = map[string]struct{}{
+	"--device-cgroup-rule": {}, "--userns": {},
+}
+
+// ValidateRuntime makes sure a container runtime (docker or nerdctl) supports the container config. nerdctl lacks
+// some flags, and takes devices as host paths only.
+func (c ContainerConfig) ValidateRuntime(rt string) error {
+	if rt != "nerdctl" {
+		return nil
+	}
+
+	for _, d := range c.Devices {
+		if strings.Contains(d, ":") {
+			return fmt.Errorf("device %s is not supported by nerdctl: only host paths are supported", d)
+		}
+	}
+	args, err := parseArgs(append(append([]string{}, c.Args...), c.RuntimeArgs[rt]...))
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, ok := nerdctlUnsupportedFlags[arg.Name]; ok {
+			return fmt.Errorf("runtime arg %s is not supported by nerdctl", arg.Name)
+		}
+		if arg.Name == "--device" && strings.Contains(arg.Value, ":") {
+			return fmt.Errorf("runtime arg %s=%s is not supported by nerdctl: only host paths are supported", arg.Name, arg.Value)
+		}
+	}
+	return nil
+}
+
+// runtimeArgs returns the parsed args for all container runtimes
+func (c ContainerConfig) runtimeArgs() ([]runtimeArg, error) {
+	res, err := parseArgs(c.Args)
+	if err != nil {
+		return nil, err
+	}
+	for _, args := range c.RuntimeArgs {
+		ra, err := parseArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ra...)
+	}
+	return res, nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+)
+
+const (
+	// secretCmdPrefix references a secret resolved by a provider command: secret://cmd/<provider>/<key>
+	secretCmdPrefix = "secret://cmd/"
+	// secretFilePrefix references a secret stored in a file: file://<path>
+	secretFilePrefix = "file://"
+
+	secretTimeout = 30 * time.Second
+)
+
+// SecretProvider resolves secret references by running a command, e.g. pass show, op read or vault kv get
+type SecretProvider struct {
+	// Command prints the secret. {key} in the arguments is replaced with the key of the reference,
+	// otherwise the key is passed as last argument.
+	Command []string `yaml:"command"`
+	// Projects lists the repositories whose .run-gp.yaml may reference secrets of this provider.
+	// Without an entry, only your own environment variables can use the provider.
+	Projects []SecretGrant `yaml:"projects,omitempty"`
+}
+
+// SecretGrant allows the projects of the repositories matching the pattern to reference some keys of a provider
+type SecretGrant struct {
+	// RepositoryPattern has the form owner/repo, see EnvVar
+	RepositoryPattern string `yaml:"repositoryPattern"`
+	// Keys are the keys the projects may reference. They can be globs, where * does not match /.
+	Keys []string `yaml:"keys"`
+}
+
+// allows returns true if the grant lets the project of a repository reference a key
+func (g SecretGrant) allows(owner, repo, key string) bool {
+	if !(EnvVar{RepositoryPattern: g.RepositoryPattern}).Matches(owner, repo) {
+		return false
+	}
+	for _, k := range g.Keys {
+		if ok, _ := path.Match(k, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSecretRef returns true if the value references a secret instead of being the value itself
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, secretCmdPrefix) || strings.HasPrefix(value, secretFilePrefix)
+}
+
+// ResolveEnv resolves all secret references in env. The resolved secrets are masked in all logs.
+func (cfg *Config) ResolveEnv(ctx context.Context, env map[string]string) (map[string]string, error) {
+	res := make(map[string]string, len(env))
+	for name, value := range env {
+		if !IsSecretRef(value) {
+			res[name] = value
+			continue
+		}
+
+		secret, err := cfg.resolveSecret(ctx, value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s: %w", name, err)
+		}
+		console.RegisterSecret(secret)
+		res[name] = secret
+	}
+	return res, nil
+}
+
+// ResolveProjectEnv resolves the secret references in the env of the project of a repository. Unlike your own
+// variables, projects cannot read files, and they can only use the provider keys granted to the repository.
+func (cfg *Config) ResolveProjectEnv(ctx context.Context, env map[string]string, owner, repo string) (map[string]string, error) {
+	for name, value := range env {
+		if strings.HasPrefix(value, secretFilePrefix) {
+			return nil, fmt.Errorf("cannot resolve %s: projects cannot reference %s secrets", name, secretFilePrefix)
+		}
+		if !strings.HasPrefix(value, secretCmdPrefix) {
+			continue
+		}
+		provider, key, err := parseSecretCmdRef(value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s: %w", name, err)
+		}
+		if !cfg.grantsSecret(provider, key, owner, repo) {
+			return nil, fmt.Errorf("cannot resolve %s: %s/%s is not granted to this repository - add it to the projects of secret provider %s in the run-gp config", name, provider, key, provider)
+		}
+	}
+	return cfg.ResolveEnv(ctx, env)
+}
+
+// grantsSecret returns true if the user allowed the project of a repository to reference a key of a provider
+func (cfg *Config) grantsSecret(provider, key, owner, repo string) bool {
+	p, ok := cfg.SecretProviders[provider]
+	if !ok {
+		return false
+	}
+	for _, g := range p.Projects {
+		if g.allows(owner, repo, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSecretCmdRef splits secret://cmd/<provider>/<key> into provider and key
+func parseSecretCmdRef(ref string) (provider, key string, err error) {
+	segs := strings.SplitN(strings.TrimPrefix(ref, secretCmdPrefix), "/", 2)
+	if len(segs) != 2 || segs[0] == "" || segs[1] == "" {
+		return "", "", fmt.Errorf("invalid secret reference: expected %s<provider>/<key>", secretCmdPrefix)
+	}
+	return segs[0], segs[1], nil
+}
+
+func (cfg *Config) resolveSecret(ctx context.Context, ref string) (string, error) {
+	if strings.HasPrefix(ref, secretFilePrefix) {
+		fn := strings.TrimPrefix(ref, secretFilePrefix)
+		if strings.HasPrefix(fn, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			fn = filepath.Join(home, fn[2:])
+		}
+		fc, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(fc), "\r\n"), nil
+	}
+
+	name, key, err := parseSecretCmdRef(ref)
+	if err != nil {
+		return "", err
+	}
+	provider, ok := cfg.SecretProviders[name]
+	if !ok || len(provider.Command) == 0 {
+		return "", fmt.Errorf("unknown secret provider %s - add it to secretProviders in the run-gp config", name)
+	}
+
+	var (
+		args     []string
+		replaced bool
+	)
+	for _, arg := range provider.Command[1:] {
+		if strings.Contains(arg, "{key}") {
+			arg = strings.ReplaceAll(arg, "{key}", key)
+			replaced = true
+		}
+		args = append(args, arg)
+	}
+	if !replaced {
+		args = append(args, key)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, secretTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, provider.Command[0], args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		// the output might contain the secret, hence we only report stderr
+		return "", fmt.Errorf("secret provider %s failed: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
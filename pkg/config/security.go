@@ -0,0 +1,247 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// SecurityProfileStrict runs the workspace with a minimal set of capabilities
+	SecurityProfileStrict = "strict"
+	// SecurityProfileDefault runs the workspace with the default capabilities of the container runtime
+	SecurityProfileDefault = "default"
+	// SecurityProfilePrivileged runs the workspace privileged and gives it access to the Docker daemon of the host
+	SecurityProfilePrivileged = "privileged"
+)
+
+// ValidateSecurityProfile checks if a security profile is supported. The empty profile means not set.
+func ValidateSecurityProfile(profile string) error {
+	switch profile {
+	case "", SecurityProfileStrict, SecurityProfileDefault, SecurityProfilePrivileged:
+		return nil
+	default:
+		return fmt.Errorf("unsupported security profile %q: only %s, %s and %s are supported", profile, SecurityProfileStrict, SecurityProfileDefault, SecurityProfilePrivileged)
+	}
+}
+
+// securityProfileLevel orders the security profiles from most to least restrictive
+var securityProfileLevel = map[string]int{
+	SecurityProfileStrict:     0,
+	SecurityProfileDefault:    1,
+	SecurityProfilePrivileged: 2,
+}
+
+// SecurityProfile determines the security profile of a workspace. allowed is the profile the user chose, on the
+// command line or in the run-gp config, and defaults to SecurityProfileDefault. It's the least restrictive profile
+// the workspace gets: projects can request a more restrictive profile, but requesting a less restrictive one fails.
+func SecurityProfile(allowed, requested string) (string, error) {
+	if allowed == "" {
+		allowed = SecurityProfileDefault
+	}
+	err := ValidateSecurityProfile(allowed)
+	if err != nil {
+		return "", err
+	}
+	err = ValidateSecurityProfile(requested)
+	if err != nil {
+		return "", err
+	}
+	if requested == "" {
+		return allowed, nil
+	}
+	if securityProfileLevel[requested] > securityProfileLevel[allowed] {
+		return "", fmt.Errorf("%s requests security profile %s, but only %s is allowed: use --security-profile=%s to run it anyway", ProjectConfigFile, requested, allowed, requested)
+	}
+	return requested, nil
+}
+
+var (
+	// privilegedCapabilities allow a container to break out, hence require the privileged profile
+	privilegedCapabilities = map[string]struct{}{
+		"ALL": {}, "BPF": {}, "DAC_READ_SEARCH": {}, "MAC_ADMIN": {}, "MAC_OVERRIDE": {}, "PERFMON": {},
+		"SYS_ADMIN": {}, "SYS_BOOT": {}, "SYS_MODULE": {}, "SYS_RAWIO": {}, "SYS_TIME": {}, "SYSLOG": {},
+	}
+	// hostNamespaceFlags share a namespace with the host if their value is host
+	hostNamespaceFlags = map[string]struct{}{
+		"--cgroupns": {}, "--ipc": {}, "--pid": {}, "--userns": {}, "--uts": {},
+	}
+	// allowedDevices are the devices workspaces can use below the privileged profile, in addition to /dev/dri/*
+	allowedDevices = map[string]struct{}{
+		"/dev/kvm": {}, "/dev/fuse": {}, "/dev/net/tun": {},
+	}
+	// daemonSockets are the sockets of container runtimes on the host
+	daemonSockets = []string{
+		"/var/run/docker.sock", "/run/docker.sock",
+		"/run/containerd/containerd.sock", "/run/buildkit/buildkitd.sock", "/run/podman/podman.sock",
+	}
+)
+
+// ValidateProfile checks if the container config can be applied with a security profile. Below the privileged
+// profile, mounts of / or runtime sockets, capabilities which allow for breaking out of the container and sharing
+// namespaces with the host are not supported, nor are other runtimes or protecting the workspace from the OOM killer.
+// Mounts and devices must use the mounts and devices sections.
+// Mount sources must be in the projects directory, see projectsDir.
+// Other sources must be read-only and need the user's consent, which allowHostMounts gives. Only the devices in
+// allowedDevices are supported. The strict profile does not allow for additional capabilities or devices at all.
+func (c ContainerConfig) ValidateProfile(workdir, profile string, allowHostMounts bool) error {
+	if profile == SecurityProfilePrivileged {
+		return nil
+	}
+
+	projects, err := projectsDir(workdir)
+	if err != nil {
+		return err
+	}
+	for _, m := range c.Mounts {
+		src, err := m.SourcePath(workdir)
+		if err != nil {
+			return err
+		}
+		err = validateMountSource(src)
+		if err != nil {
+			return fmt.Errorf("cannot mount %s with security profile %s: %w", m.Source, profile, err)
+		}
+		if resolved, err := filepath.EvalSymlinks(src); err == nil {
+			src = resolved
+		}
+		if within(projects, src) {
+			continue
+		}
+		if !m.ReadOnly {
+			return fmt.Errorf("cannot mount %s with security profile %s: mounts outside of %s must be read-only", m.Source, profile, projects)
+		}
+		if !allowHostMounts {
+			return fmt.Errorf("%s mounts %s from outside of %s: use --allow-host-mounts to mount it anyway", ProjectConfigFile, m.Source, projects)
+		}
+	}
+	if profile == SecurityProfileStrict && len(c.Devices) > 0 {
+		return fmt.Errorf("devices are not supported with security profile %s", profile)
+	}
+	for _, d := range c.Devices {
+		err := validateDevice(strings.SplitN(d, ":", 2)[0])
+		if err != nil {
+			return fmt.Errorf("device %s is not supported with security profile %s: %w", d, profile, err)
+		}
+	}
+	for _, capability := range c.Capabilities {
+		err := validateCapability(profile, capability)
+		if err != nil {
+			return err
+		}
+	}
+
+	args, err := c.runtimeArgs()
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		switch arg.Name {
+		case "--volume", "--mount":
+			return fmt.Errorf("runtime arg %s is not supported with security profile %s: use mounts instead", arg.Name, profile)
+		case "--device", "--device-cgroup-rule":
+			return fmt.Errorf("runtime arg %s is not supported with security profile %s: use devices instead", arg.Name, profile)
+		case "--cap-add":
+			return fmt.Errorf("runtime arg %s is not supported with security profile %s: use capabilities instead", arg.Name, profile)
+		case "--runtime", "--oom-kill-disable":
+			return fmt.Errorf("runtime arg %s is not supported with security profile %s", arg.Name, profile)
+		case "--oom-score-adj":
+			if strings.HasPrefix(strings.TrimSpace(arg.Value), "-") {
+				return fmt.Errorf("runtime arg %s=%s is not supported with security profile %s: the score cannot be lowered", arg.Name, arg.Value, profile)
+			}
+		case "--gpus":
+			if profile == SecurityProfileStrict {
+				return fmt.Errorf("runtime arg %s is not supported with security profile %s", arg.Name, profile)
+			}
+		case "--security-opt":
+			if opt := strings.Replace(arg.Value, ":", "=", 1); opt != "no-new-privileges" && opt != "no-new-privileges=true" {
+				return fmt.Errorf("runtime arg %s=%s is not supported with security profile %s", arg.Name, arg.Value, profile)
+			}
+		}
+		if _, ok := hostNamespaceFlags[arg.Name]; ok && arg.Value == "host" {
+			return fmt.Errorf("runtime arg %s=host is not supported with security profile %s", arg.Name, profile)
+		}
+	}
+	return nil
+}
+
+// projectsDir returns the parent directory of the working directory, where mount sources are fine because they are
+// the project or its siblings. If the parent is / or the home directory, that is the working directory itself.
+func projectsDir(workdir string) (string, error) {
+	workdir, err := filepath.EvalSymlinks(workdir)
+	if err != nil {
+		return "", err
+	}
+	workdir, err = filepath.Abs(workdir)
+	if err != nil {
+		return "", err
+	}
+	parent := filepath.Dir(workdir)
+	if parent == filepath.Dir(parent) {
+		return workdir, nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(home); err == nil {
+			home = resolved
+		}
+		if parent == filepath.Clean(home) {
+			return workdir, nil
+		}
+	}
+	return parent, nil
+}
+
+func validateCapability(profile, capability string) error {
+	if profile == SecurityProfileStrict {
+		return fmt.Errorf("capabilities are not supported with security profile %s", profile)
+	}
+	if _, ok := privilegedCapabilities[strings.TrimPrefix(strings.ToUpper(capability), "CAP_")]; ok {
+		return fmt.Errorf("capability %s requires security profile %s", capability, SecurityProfilePrivileged)
+	}
+	return nil
+}
+
+// validateDevice makes sure a host device is one of allowedDevices or a GPU in /dev/dri, also once symlinks are resolved
+func validateDevice(dev string) error {
+	paths := []string{filepath.Clean(dev)}
+	if resolved, err := filepath.EvalSymlinks(dev); err == nil && resolved != paths[0] {
+		paths = append(paths, resolved)
+	}
+	for _, p := range paths {
+		if _, ok := allowedDevices[p]; ok {
+			continue
+		}
+		if strings.HasPrefix(p, "/dev/dri/") {
+			continue
+		}
+		return fmt.Errorf("only /dev/kvm, /dev/fuse, /dev/net/tun and /dev/dri/* are supported")
+	}
+	return nil
+}
+
+// validateMountSource makes sure a host path neither is / nor exposes the socket of a container runtime
+func validateMountSource(src string) error {
+	if resolved, err := filepath.EvalSymlinks(src); err == nil {
+		src = resolved
+	}
+	if src == "/" || src == filepath.VolumeName(src)+string(filepath.Separator) {
+		return fmt.Errorf("cannot mount the root directory")
+	}
+	if stat, err := os.Stat(src); err == nil && stat.Mode()&os.ModeSocket != 0 {
+		return fmt.Errorf("cannot mount sockets")
+	}
+	for _, sock := range daemonSockets {
+		if resolved, err := filepath.EvalSymlinks(sock); err == nil {
+			sock = resolved
+		}
+		if sock == src || strings.HasPrefix(sock, src+string(filepath.Separator)) {
+			return fmt.Errorf("cannot mount %s which contains the container runtime socket %s", src, sock)
+		}
+	}
+	return nil
+}
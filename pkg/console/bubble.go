@@ -10,12 +10,15 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/opener"
 	"github.com/mattn/go-isatty"
 	"github.com/muesli/reflow/indent"
 	"github.com/pterm/pterm"
@@ -119,13 +122,13 @@ func (*BubbleTeaUI) Infof(format string, args ...interface{}) {
 // Warnf implements Log
 func (ui *BubbleTeaUI) Warnf(format string, args ...interface{}) {
 	logrus.Warnf(format, args...)
-	ui.sendMsg(msgWarning(fmt.Sprintf(format, args...)))
+	ui.sendMsg(msgWarning(Mask(fmt.Sprintf(format, args...))))
 }
 
 // StartPhase implements Log
 func (ui *BubbleTeaUI) StartPhase(name string, description string) Phase {
 	desc := name + " " + description
-	ui.sendMsg(msgPhaseStart(desc))
+	ui.sendMsg(msgPhaseStart(Mask(desc)))
 	return &bubblePhase{
 		parent: ui,
 		start:  time.Now(),
@@ -141,7 +144,7 @@ func (ui *BubbleTeaUI) Writer() Logs {
 		r := bufio.NewScanner(rr)
 		for r.Scan() {
 			l := r.Text()
-			ui.sendMsg(msgLogLine(l))
+			ui.sendMsg(msgLogLine(Mask(l)))
 		}
 	}()
 
@@ -152,6 +155,48 @@ func (ui *BubbleTeaUI) SetWorkspaceAccess(info WorkspaceAccess) {
 	ui.sendMsg(msgSetWorkspaceAccess(info))
 }
 
+// SetTask implements Log
+func (ui *BubbleTeaUI) SetTask(task Task) {
+	ui.sendMsg(msgSetTask(task))
+}
+
+// SetProgress implements Log
+func (ui *BubbleTeaUI) SetProgress(progress Progress) {
+	ui.sendMsg(msgSetProgress(progress))
+}
+
+// Notify implements Log
+func (ui *BubbleTeaUI) Notify(message string) {
+	logrus.WithField("message", message).Info("notification from workspace")
+	ui.sendMsg(msgNotification(Mask(message)))
+}
+
+// TaskWriter implements Log
+func (ui *BubbleTeaUI) TaskWriter(id string) io.WriteCloser {
+	rr, rw := io.Pipe()
+
+	go func() {
+		r := bufio.NewScanner(rr)
+		for r.Scan() {
+			ui.sendMsg(msgTaskLogLine{ID: id, Line: Mask(sanitizeTerminalLine(r.Text()))})
+		}
+	}()
+
+	return rw
+}
+
+var nonSGREscapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-ln-z]|\x1b\][^\x07]*\x07|\x1b[()][A-Z0-9]`)
+
+// sanitizeTerminalLine removes all escape sequences except for colors from terminal output,
+// and only keeps what's printed after the last carriage return.
+func sanitizeTerminalLine(l string) string {
+	l = strings.TrimRight(l, "\r")
+	if idx := strings.LastIndex(l, "\r"); idx >= 0 {
+		l = l[idx+1:]
+	}
+	return nonSGREscapeSequence.ReplaceAllString(l, "")
+}
+
 type bubbleLogs struct {
 	io.WriteCloser
 	parent *BubbleTeaUI
@@ -172,7 +217,7 @@ func (p *bubblePhase) Failure(reason string) {
 	p.parent.sendMsg(msgPhaseDone{
 		Duration: time.Since(p.start),
 		Desc:     p.desc,
-		Failure:  reason,
+		Failure:  Mask(reason),
 	})
 }
 
@@ -190,6 +235,13 @@ type msgLogLine string
 type msgDiscardLogs struct{}
 type msgWarning string
 type msgSetWorkspaceAccess WorkspaceAccess
+type msgSetTask Task
+type msgNotification string
+type msgSetProgress Progress
+type msgTaskLogLine struct {
+	ID   string
+	Line string
+}
 
 var _ Log = &BubbleTeaUI{}
 
@@ -198,10 +250,19 @@ type uiModel struct {
 	phases       []uiPhase
 	currentPhase string
 
-	warnings []string
+	warnings      []string
+	notifications []string
 
 	workspaceAccess *WorkspaceAccess
 
+	progress []Progress
+
+	tasks    []Task
+	taskLogs map[string][]string
+	// selectedTask is the 1-based index of the task whose output we show.
+	// 0 shows the workspace logs.
+	selectedTask int
+
 	quitting bool
 	done     chan struct{}
 	logs     []string
@@ -218,8 +279,9 @@ func newUIModel() uiModel {
 	sp.Spinner = spinner.Points
 	sp.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("#ff8a00"))
 	return uiModel{
-		spinner: sp,
-		done:    make(chan struct{}),
+		spinner:  sp,
+		done:     make(chan struct{}),
+		taskLogs: make(map[string][]string),
 	}
 }
 
@@ -255,15 +317,69 @@ func (m uiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		v := WorkspaceAccess(msg)
 		m.workspaceAccess = &v
 		logrus.WithField("SSH port", v.SSHPort).WithField("URL", v.URL).Infof("workspace is available")
+	case msgSetTask:
+		t := Task(msg)
+		var found bool
+		for i := range m.tasks {
+			if m.tasks[i].ID == t.ID {
+				m.tasks[i] = t
+				found = true
+				break
+			}
+		}
+		if !found {
+			m.tasks = append(m.tasks, t)
+		}
+		logrus.WithField("task", t.Name).Infof("task is %s", t.State)
+	case msgSetProgress:
+		p := Progress(msg)
+		var found bool
+		for i := range m.progress {
+			if m.progress[i].ID == p.ID {
+				m.progress[i] = p
+				found = true
+				break
+			}
+		}
+		if !found {
+			m.progress = append(m.progress, p)
+		}
+		logrus.WithField("done", p.Done).WithField("total", p.Total).Infof("%s: %s", p.Name, p.Current)
+	case msgTaskLogLine:
+		lines := append(m.taskLogs[msg.ID], msg.Line)
+		if len(lines) > maxTaskLogLines {
+			lines = lines[len(lines)-maxTaskLogLines:]
+		}
+		m.taskLogs[msg.ID] = lines
 	case msgDiscardLogs:
 		m.logs = nil
 	case msgWarning:
 		m.warnings = append(m.warnings, string(msg))
+	case msgNotification:
+		m.notifications = append(m.notifications, string(msg))
+		if len(m.notifications) > maxNotifications {
+			m.notifications = m.notifications[1:]
+		}
 	case tea.KeyMsg:
 		if msg.Type == tea.KeyCtrlC || msg.Type == tea.KeyCtrlQ || msg.String() == "q" {
 			m.quitting = true
 			return m, tea.Quit
 		}
+		switch msg.Type {
+		case tea.KeyTab, tea.KeyDown:
+			m.selectedTask = (m.selectedTask + 1) % (len(m.tasks) + 1)
+		case tea.KeyShiftTab, tea.KeyUp:
+			m.selectedTask = (m.selectedTask + len(m.tasks)) % (len(m.tasks) + 1)
+		case tea.KeyEsc:
+			m.selectedTask = 0
+		case tea.KeyRunes:
+			if msg.String() == "o" && m.workspaceAccess != nil {
+				return m, openURL(m.workspaceAccess.URL)
+			}
+			if n, err := strconv.Atoi(msg.String()); err == nil && n <= len(m.tasks) {
+				m.selectedTask = n
+			}
+		}
 		return m, nil
 	case spinner.TickMsg:
 		var cmd tea.Cmd
@@ -273,6 +389,32 @@ func (m uiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+const (
+	maxTaskLogLines  = 10
+	maxNotifications = 3
+	progressBarWidth = 20
+)
+
+// openURL opens a URL on the host without blocking the UI
+func openURL(url string) tea.Cmd {
+	return func() tea.Msg {
+		err := opener.Open(url)
+		if err != nil {
+			return msgWarning(err.Error())
+		}
+		return nil
+	}
+}
+
+// progressBar renders a progress bar of progressBarWidth characters
+func progressBar(done, total int) string {
+	filled := progressBarWidth
+	if total > 0 && done < total {
+		filled = done * progressBarWidth / total
+	}
+	return styleProgressBar(strings.Repeat("█", filled)) + styleTaskState(strings.Repeat("░", progressBarWidth-filled))
+}
+
 var banner = `    
    _______  ______     ____ _____ 
   / ___/ / / / __ \   / __ ` + "`" + `/ __ \
@@ -287,8 +429,13 @@ var (
 	stylePhaseDuration    = lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Italic(true).Render
 	styleHelp             = lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render
 	styleWarning          = lipgloss.NewStyle().Background(lipgloss.Color("#ffbe5c")).Bold(true).Render
+	styleNotification     = lipgloss.NewStyle().Background(lipgloss.Color("#2f80ed")).Bold(true).Render
 	styleWorkspaceURLDesc = lipgloss.NewStyle().Bold(true).Render
 	styleWorkspaceURL     = lipgloss.NewStyle().Bold(true).Underline(true).Render
+	styleTaskSelected     = lipgloss.NewStyle().Bold(true).Render
+	styleTaskFailed       = lipgloss.NewStyle().Foreground(lipgloss.Color("#f51f1f")).Render
+	styleTaskState        = lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render
+	styleProgressBar      = lipgloss.NewStyle().Foreground(lipgloss.Color("#ff8a00")).Render
 )
 
 func (m uiModel) View() string {
@@ -311,9 +458,27 @@ func (m uiModel) View() string {
 		s += "\n"
 	}
 
+	if len(m.notifications) > 0 {
+		for _, n := range m.notifications {
+			s += styleNotification(" NOTICE ") + " " + n + "\n"
+		}
+		s += "\n"
+	}
+
 	if m.workspaceAccess != nil {
 		s += styleWorkspaceURLDesc("Open the workspace at: ") + styleWorkspaceURL(m.workspaceAccess.URL) + "\n"
-		s += styleWorkspaceURLDesc("            SSH using: ") + fmt.Sprintf("ssh -p %d gitpod@localhost", m.workspaceAccess.SSHPort) + "\n"
+		switch {
+		case m.workspaceAccess.SSHHost != "":
+			s += styleWorkspaceURLDesc("            SSH using: ") + "ssh " + m.workspaceAccess.SSHHost + "\n"
+		case m.workspaceAccess.SSHPort > 0:
+			s += styleWorkspaceURLDesc("            SSH using: ") + fmt.Sprintf("ssh -p %d gitpod@localhost", m.workspaceAccess.SSHPort) + "\n"
+		}
+		if m.workspaceAccess.SSHIdentity != "" {
+			s += styleWorkspaceURLDesc("         SSH identity: ") + m.workspaceAccess.SSHIdentity + "\n"
+		}
+		if m.workspaceAccess.GatewayURL != "" {
+			s += styleWorkspaceURLDesc("    JetBrains Gateway: ") + styleWorkspaceURL(m.workspaceAccess.GatewayURL) + "\n"
+		}
 		s += "\n"
 	}
 
@@ -334,7 +499,42 @@ func (m uiModel) View() string {
 		s += "      " + m.spinner.View() + " " + m.currentPhase + "\n\n"
 	}
 
-	for _, res := range m.logs {
+	for _, p := range m.progress {
+		s += styleWorkspaceURLDesc(p.Name+": ") + progressBar(p.Done, p.Total) + fmt.Sprintf(" %d/%d", p.Done, p.Total)
+		if p.Current != "" {
+			s += " " + styleTaskState(p.Current)
+		}
+		s += "\n"
+	}
+	if len(m.progress) > 0 {
+		s += "\n"
+	}
+
+	if len(m.tasks) > 0 {
+		s += styleWorkspaceURLDesc("Tasks:") + "\n"
+		for i, t := range m.tasks {
+			marker := "  "
+			name := t.Name
+			if m.selectedTask == i+1 {
+				marker = "▸ "
+				name = styleTaskSelected(name)
+			}
+			state := styleTaskState(t.State)
+			if t.Failed {
+				state = styleTaskFailed(t.State)
+			}
+			s += fmt.Sprintf("%s%d %s  %s\n", marker, i+1, name, state)
+		}
+		s += "\n"
+	}
+
+	logs := m.logs
+	if m.selectedTask > 0 && m.selectedTask <= len(m.tasks) {
+		t := m.tasks[m.selectedTask-1]
+		s += styleHelp("Output of "+t.Name+":") + "\n"
+		logs = m.taskLogs[t.ID]
+	}
+	for _, res := range logs {
 		s += res + "\n"
 	}
 	s += "\n"
@@ -342,7 +542,14 @@ func (m uiModel) View() string {
 	if m.quitting {
 		s += styleWarning("  SHUTTING DOWN  ")
 	} else {
-		s += styleHelp("Press q to quit") + "\n"
+		help := "Press q to quit"
+		if m.workspaceAccess != nil {
+			help += ", o to open the workspace in the browser"
+		}
+		if len(m.tasks) > 0 {
+			help += ", tab or 1-9 to show the output of a task, esc to show the workspace logs"
+		}
+		s += styleHelp(help) + "\n"
 	}
 
 	return indent.String(s, 1)
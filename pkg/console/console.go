@@ -23,6 +23,17 @@ type Log interface {
 
 	SetWorkspaceAccess(info WorkspaceAccess)
 
+	// SetTask adds or updates a workspace task
+	SetTask(task Task)
+	// TaskWriter starts a log printing session for the output of a task
+	TaskWriter(id string) io.WriteCloser
+
+	// Notify shows a notification sent by the workspace
+	Notify(message string)
+
+	// SetProgress adds or updates the progress of a background activity
+	SetProgress(progress Progress)
+
 	StartPhase(name, description string) Phase
 	Debugf(format string, args ...interface{})
 	Infof(format string, args ...interface{})
@@ -65,21 +76,69 @@ func (c ConsoleLog) Warnf(format string, args ...interface{}) {
 
 // Log implements Log
 func (c ConsoleLog) Writer() Logs {
-	return noopWriteCloser{c.w}
+	if c.w == nil {
+		return noopWriteCloser{io.Discard}
+	}
+	return &maskingWriter{w: c.w}
 }
 
 func (c ConsoleLog) SetWorkspaceAccess(info WorkspaceAccess) {
 	c.Infof("workspace access: %v", info)
 }
 
+func (c ConsoleLog) SetTask(task Task) {
+	c.Infof("task %s: %s", task.Name, task.State)
+}
+
+func (c ConsoleLog) Notify(message string) {
+	c.Infof("notification from workspace: %s", message)
+}
+
+func (c ConsoleLog) SetProgress(progress Progress) {
+	c.Infof("%s: %d/%d %s", progress.Name, progress.Done, progress.Total, progress.Current)
+}
+
+func (c ConsoleLog) TaskWriter(id string) io.WriteCloser {
+	if c.w == nil {
+		return noopWriteCloser{io.Discard}
+	}
+	return &maskingWriter{w: c.w}
+}
+
+// Task describes a workspace task
+type Task struct {
+	ID    string
+	Name  string
+	State string
+	// Failed is true if the task exited with a non-zero exit code
+	Failed bool
+}
+
+// Progress describes the progress of a background activity, e.g. installing extensions
+type Progress struct {
+	ID    string
+	Name  string
+	Done  int
+	Total int
+	// Current describes what's in progress, e.g. the extension being installed
+	Current string
+}
+
 type WorkspaceAccess struct {
-	URL     string
-	SSHPort int
+	URL string
+	// WorkspaceFolder is the folder or .code-workspace file in the workspace to open
+	WorkspaceFolder string
+	SSHPort         int
+	// SSHHost is the host alias in the user's SSH config, if there is one
+	SSHHost string
+	// SSHIdentity describes the key to connect with
+	SSHIdentity string
+	GatewayURL  string
 }
 
 // StartPhase implements Log
 func (c ConsoleLog) StartPhase(name, description string) Phase {
-	fmt.Fprintf(c.w, "[%s] %s\n", name, description)
+	fmt.Fprintf(c.w, "[%s] %s\n", name, Mask(description))
 	return consolePhase{
 		w: c.w,
 		n: name,
@@ -96,7 +155,7 @@ func (c consolePhase) Success() {
 }
 
 func (c consolePhase) Failure(reason string) {
-	fmt.Fprintf(c.w, "[%s] FAILED! %s\n", c.n, reason)
+	fmt.Fprintf(c.w, "[%s] FAILED! %s\n", c.n, Mask(reason))
 }
 
 type noopWriteCloser struct{ io.Writer }
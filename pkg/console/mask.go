@@ -0,0 +1,121 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package console
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minSecretLen is the minimum length of a masked secret. Masking shorter values would garble the logs.
+const minSecretLen = 4
+
+const masked = "****"
+
+var secrets struct {
+	mu       sync.RWMutex
+	values   map[string]struct{}
+	replacer *strings.Replacer
+}
+
+// RegisterSecret makes sure a value never shows in any log, e.g. a resolved secret environment variable
+func RegisterSecret(value string) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+
+	if secrets.values == nil {
+		secrets.values = make(map[string]struct{})
+	}
+	// secrets spanning several lines show up line by line in the logs
+	for _, v := range append([]string{value}, strings.Split(value, "\n")...) {
+		v = strings.TrimSpace(v)
+		if len(v) < minSecretLen {
+			continue
+		}
+		secrets.values[v] = struct{}{}
+	}
+
+	var oldnew []string
+	for v := range secrets.values {
+		oldnew = append(oldnew, v, masked)
+	}
+	secrets.replacer = strings.NewReplacer(oldnew...)
+}
+
+// Mask replaces all registered secrets in s
+func Mask(s string) string {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+
+	if secrets.replacer == nil {
+		return s
+	}
+	return secrets.replacer.Replace(s)
+}
+
+// maskingWriter masks the secrets in everything written to it. It buffers partial lines
+// so that secrets split across writes are masked, too.
+type maskingWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+func (m *maskingWriter) Write(p []byte) (n int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.buf = append(m.buf, p...)
+	i := bytes.LastIndexByte(m.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	_, err = io.WriteString(m.w, Mask(string(m.buf[:i+1])))
+	m.buf = append(m.buf[:0], m.buf[i+1:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes what remains of a partial line
+func (m *maskingWriter) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(m.w, Mask(string(m.buf)))
+	m.buf = nil
+	return err
+}
+
+func (*maskingWriter) Discard() {}
+
+// maskHook masks the secrets in all log entries
+type maskHook struct{}
+
+func (maskHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (maskHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Mask(entry.Message)
+	for k, v := range entry.Data {
+		if s, ok := v.(string); ok {
+			entry.Data[k] = Mask(s)
+		}
+	}
+	return nil
+}
+
+func init() {
+	logrus.AddHook(maskHook{})
+}
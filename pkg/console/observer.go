@@ -6,96 +6,310 @@ package console
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/supervisor"
 )
 
 type WorkspaceAccessInfo struct {
 	WorkspaceFolder string
-	HTTPPort        int
-	SSHPort         int
+	// BaseURL is the URL the IDE is reachable at, e.g. http://localhost:8080
+	BaseURL string
+	SSHPort int
+	// SSHHost is the host alias in the user's SSH config, if there is one
+	SSHHost string
+	// SSHIdentity describes the key to connect with
+	SSHIdentity string
+	// GatewayURL connects JetBrains Gateway to the workspace, if a JetBrains backend is available
+	GatewayURL string
+}
+
+// WorkspaceTasks describes the tasks run-gp passed to the workspace
+type WorkspaceTasks struct {
+	// Names are the task names in the order of the .gitpod.yml
+	Names []string
+	// Progress returns the phase (before, init, command) the i-th task is in, and its exit code once it exited
+	Progress func(i int) (phase string, exitCode int, exited bool)
 }
 
-func Observe(log Log, access WorkspaceAccessInfo, onFail func()) Logs {
+// Observe follows the workspace startup using supervisor's status API and reports the phases to log.
+// The returned logs receive the output of the container runtime.
+func Observe(ctx context.Context, log Log, access WorkspaceAccessInfo, tasks WorkspaceTasks, status *supervisor.Client, onFail func()) Logs {
+	ctx, cancel := context.WithCancel(ctx)
 	rr, rw := io.Pipe()
 
-	var (
-		steady string
-		phase  = "starting"
-	)
-	p := log.StartPhase("["+phase+"]", "workspace image")
+	o := &observer{
+		log:    log,
+		access: access,
+		tasks:  tasks,
+		status: status,
+		onFail: onFail,
+		phase:  "starting",
+		steady: "workspace",
+	}
+	o.p = log.StartPhase("["+o.phase+"]", o.steady)
 
 	go func() {
-		extensions := make(map[string]struct{})
-
-		var workspaceURL string
 		scanner := bufio.NewScanner(rr)
 		for scanner.Scan() {
-			var (
-				resetPhase = true
-				failure    string
-			)
 			line := scanner.Text()
 
-			switch {
-			case strings.Contains(line, "Error response from daemon:"):
-				resetPhase = true
-				failure = line
-			case strings.Contains(line, "Web UI available"):
-				prefix := "folder"
-				if strings.HasSuffix(access.WorkspaceFolder, ".code-workspace") {
-					prefix = "workspace"
-				}
-				workspaceURL = fmt.Sprintf("http://localhost:%d/?%s=%s", access.HTTPPort, prefix, access.WorkspaceFolder)
-
-				phase = "running"
-				steady = fmt.Sprintf("workspace at %s", workspaceURL)
-				log.SetWorkspaceAccess(WorkspaceAccess{
-					URL:     workspaceURL,
-					SSHPort: access.SSHPort,
-				})
-			case strings.Contains(line, "Installing extensions"):
-				phase = "installing extensions"
-				steady = "running " + steady
-			case strings.Contains(line, "IDE was stopped"):
-				phase = "restarting"
-				steady = "the workspace"
-				failure = "IDE was stopped"
-			case strings.Contains(line, "Installing extension:"):
-				segs := strings.Split(line, "Installing extension:")
-				extensions[segs[1]] = struct{}{}
-				resetPhase = false
-			case strings.Contains(line, "Downloaded extension"):
-				for k := range extensions {
-					if strings.Contains(line, k) {
-						delete(extensions, k)
-					}
-				}
-				if len(extensions) == 0 {
-					phase = "ready"
-				} else {
-					resetPhase = false
-				}
-			default:
-				resetPhase = false
+			// Failures of the container runtime never make it to supervisor, hence we have no
+			// structured way of learning about them.
+			if strings.Contains(line, "Error response from daemon:") {
+				o.setPhase(o.phase, o.steady, line)
+			}
+		}
+	}()
+	go o.observeIDE(ctx)
+	go o.observeTasks(ctx)
+	go o.observePorts(ctx)
+
+	logs := log.Writer()
+	return &observerLogs{Writer: io.MultiWriter(rw, logs), close: func() {
+		cancel()
+		rw.Close()
+	}}
+}
+
+type observerLogs struct {
+	io.Writer
+	close func()
+}
+
+func (o *observerLogs) Close() error {
+	o.close()
+	return nil
+}
+
+func (*observerLogs) Discard() {}
+
+type observer struct {
+	log    Log
+	access WorkspaceAccessInfo
+	tasks  WorkspaceTasks
+	status *supervisor.Client
+	onFail func()
+
+	mu     sync.Mutex
+	p      Phase
+	phase  string
+	steady string
+}
+
+func (o *observer) setPhase(phase, steady, failure string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if failure != "" {
+		o.onFail()
+		o.p.Failure(failure)
+	} else {
+		o.p.Success()
+	}
+	o.phase, o.steady = phase, steady
+	o.p = o.log.StartPhase("["+phase+"]", steady)
+}
+
+// WorkspaceAccess produces the access details of the running workspace
+func (a WorkspaceAccessInfo) WorkspaceAccess() WorkspaceAccess {
+	prefix := "folder"
+	if strings.HasSuffix(a.WorkspaceFolder, ".code-workspace") {
+		prefix = "workspace"
+	}
+	return WorkspaceAccess{
+		URL:             fmt.Sprintf("%s/?%s=%s", a.BaseURL, prefix, a.WorkspaceFolder),
+		WorkspaceFolder: a.WorkspaceFolder,
+		SSHPort:         a.SSHPort,
+		SSHHost:         a.SSHHost,
+		SSHIdentity:     a.SSHIdentity,
+		GatewayURL:      a.GatewayURL,
+	}
+}
+
+const pollInterval = 2 * time.Second
+
+func (o *observer) observeIDE(ctx context.Context) {
+	err := supervisor.Retry(ctx, pollInterval, func() error {
+		_, err := o.status.ContentStatus(ctx, true)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	o.setPhase("starting", "IDE", "")
+
+	for {
+		err = supervisor.Retry(ctx, pollInterval, func() error {
+			ok, err := o.status.IDEStatus(ctx, true)
+			if err == nil && !ok {
+				err = fmt.Errorf("IDE is not ready")
+			}
+			return err
+		})
+		if err != nil {
+			return
+		}
+
+		access := o.access.WorkspaceAccess()
+		o.log.SetWorkspaceAccess(access)
+		o.setPhase("running", fmt.Sprintf("workspace at %s", access.URL), "")
+
+		// supervisor has no way of notifying us when the IDE stops, hence we poll
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
 			}
 
-			if !resetPhase {
+			ok, err := o.status.IDEStatus(ctx, false)
+			if err != nil && ctx.Err() != nil {
+				return
+			}
+			if err == nil && ok {
 				continue
 			}
-			if failure != "" {
-				onFail()
+			o.setPhase("restarting", "the workspace", "IDE was stopped")
+			break
+		}
+	}
+}
+
+func (o *observer) observeTasks(ctx context.Context) {
+	type taskState struct {
+		idx      int
+		state    supervisor.TaskState
+		listened bool
+
+		exitCode int
+		exited   bool
+
+		reported Task
+	}
+	var (
+		mu     sync.Mutex
+		states = make(map[string]*taskState)
+	)
+
+	update := func(id string) {
+		t := states[id]
+		phase, exitCode, exited := "", 0, false
+		if o.tasks.Progress != nil {
+			phase, exitCode, exited = o.tasks.Progress(t.idx)
+		}
+		if !exited && t.exited {
+			exitCode, exited = t.exitCode, true
+		}
+
+		name := fmt.Sprintf("task %d", t.idx+1)
+		if t.idx < len(o.tasks.Names) && o.tasks.Names[t.idx] != "" {
+			name = o.tasks.Names[t.idx]
+		}
+
+		task := Task{ID: id, Name: name}
+		task.State, task.Failed = DescribeTaskState(t.state, phase, exitCode, exited)
+		if task == t.reported {
+			return
+		}
+		t.reported = task
+		o.log.SetTask(task)
+	}
+
+	listen := func(id, alias string) {
+		out := o.log.TaskWriter(id)
+		defer out.Close()
+
+		exitCode, err := o.status.ListenTerminal(ctx, alias, out)
+		if err != nil {
+			o.log.Debugf("stopped listening to task %s: %v", id, err)
+			return
+		}
 
-				p.Failure(failure)
-			} else {
-				p.Success()
+		mu.Lock()
+		defer mu.Unlock()
+		states[id].exited, states[id].exitCode = true, exitCode
+		update(id)
+	}
+
+	// The task progress is recorded in the workspace state, which we cannot observe. Hence we poll.
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
 			}
-			failure = ""
-			p = log.StartPhase("["+phase+"]", steady)
+
+			mu.Lock()
+			for id := range states {
+				update(id)
+			}
+			mu.Unlock()
 		}
 	}()
 
-	logs := log.Writer()
-	return noopWriteCloser{io.MultiWriter(rw, logs)}
+	_ = supervisor.Retry(ctx, pollInterval, func() error {
+		return o.status.ObserveTasks(ctx, func(tasks []supervisor.TaskStatus) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			for i, t := range tasks {
+				st, ok := states[t.ID]
+				if !ok {
+					idx, err := strconv.Atoi(t.ID)
+					if err != nil {
+						idx = i
+					}
+					st = &taskState{idx: idx}
+					states[t.ID] = st
+				}
+				st.state = t.State
+				if !st.listened && t.Terminal != "" {
+					st.listened = true
+					go listen(t.ID, t.Terminal)
+				}
+				update(t.ID)
+			}
+		})
+	})
+}
+
+// DescribeTaskState describes the state of a task for humans
+func DescribeTaskState(state supervisor.TaskState, phase string, exitCode int, exited bool) (desc string, failed bool) {
+	switch {
+	case exited:
+		return fmt.Sprintf("exited with code %d", exitCode), exitCode != 0
+	case state == supervisor.TaskOpening:
+		return "opening", false
+	case phase == "before" || phase == "init":
+		return phase, false
+	case state == supervisor.TaskClosed:
+		return "closed", false
+	default:
+		return "running", false
+	}
+}
+
+func (o *observer) observePorts(ctx context.Context) {
+	served := make(map[int]bool)
+	_ = supervisor.Retry(ctx, pollInterval, func() error {
+		return o.status.ObservePorts(ctx, func(ports []supervisor.PortStatus) {
+			for _, p := range ports {
+				if served[p.LocalPort] == p.Served {
+					continue
+				}
+				served[p.LocalPort] = p.Served
+				if p.Served {
+					o.log.Infof("port %d is served", p.LocalPort)
+				}
+			}
+		})
+	})
 }
@@ -0,0 +1,208 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+// Package dotenv parses .env files.
+//
+// Each line holds a NAME=value assignment, optionally prefixed with "export". Lines starting with # are comments.
+// Values can be
+//   - unquoted: surrounding whitespace is trimmed and a # preceded by whitespace starts a comment
+//   - single-quoted: the value is taken literally and may span several lines
+//   - double-quoted: \n, \r, \t, \", \\ and \$ are unescaped and the value may span several lines
+//
+// Variables are not expanded.
+package dotenv
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ReadFile parses a .env file
+func ReadFile(fn string) (map[string]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return res, nil
+}
+
+// Parse parses the content of a .env file
+func Parse(r io.Reader) (map[string]string, error) {
+	fc, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{src: strings.ReplaceAll(string(fc), "\r\n", "\n"), line: 1}
+	res := make(map[string]string)
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return res, nil
+		}
+		if p.peek() == '#' {
+			p.skipLine()
+			continue
+		}
+
+		name, value, err := p.assignment()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line, err)
+		}
+		res[name] = value
+	}
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) eof() bool  { return p.pos >= len(p.src) }
+func (p *parser) peek() byte { return p.src[p.pos] }
+
+func (p *parser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipBlank skips whitespace including newlines
+func (p *parser) skipBlank() {
+	for !p.eof() && strings.IndexByte(" \t\n", p.peek()) >= 0 {
+		p.next()
+	}
+}
+
+// skipSpace skips whitespace on the current line
+func (p *parser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+}
+
+func (p *parser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+func (p *parser) assignment() (name, value string, err error) {
+	start := p.pos
+	for !p.eof() && p.peek() != '=' && p.peek() != '\n' {
+		p.next()
+	}
+	if p.eof() || p.peek() != '=' {
+		return "", "", fmt.Errorf("expected NAME=value")
+	}
+	name = strings.TrimSpace(p.src[start:p.pos])
+	if strings.HasPrefix(name, "export ") || strings.HasPrefix(name, "export\t") {
+		name = strings.TrimSpace(name[len("export"):])
+	}
+	if !validName.MatchString(name) {
+		return "", "", fmt.Errorf("invalid variable name %q", name)
+	}
+	p.next() // =
+	p.skipSpace()
+
+	if p.eof() {
+		return name, "", nil
+	}
+	switch p.peek() {
+	case '\'':
+		value, err = p.singleQuoted()
+	case '"':
+		value, err = p.doubleQuoted()
+	default:
+		return name, p.unquoted(), nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	// only a comment may follow a quoted value
+	p.skipSpace()
+	if !p.eof() && p.peek() != '\n' && p.peek() != '#' {
+		return "", "", fmt.Errorf("unexpected characters after the value of %s", name)
+	}
+	p.skipLine()
+	return name, value, nil
+}
+
+func (p *parser) unquoted() string {
+	start := p.pos
+	for !p.eof() && p.peek() != '\n' {
+		if p.peek() == '#' && p.pos > start && strings.IndexByte(" \t", p.src[p.pos-1]) >= 0 {
+			break
+		}
+		p.next()
+	}
+	value := strings.TrimSpace(p.src[start:p.pos])
+	p.skipLine()
+	return value
+}
+
+func (p *parser) singleQuoted() (string, error) {
+	startLine := p.line
+	p.next()
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		p.next()
+	}
+	if p.eof() {
+		return "", fmt.Errorf("unterminated single-quoted value starting on line %d", startLine)
+	}
+	value := p.src[start:p.pos]
+	p.next()
+	return value, nil
+}
+
+func (p *parser) doubleQuoted() (string, error) {
+	startLine := p.line
+	p.next()
+	var b strings.Builder
+	for !p.eof() {
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				break
+			}
+			e := p.next()
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated double-quoted value starting on line %d", startLine)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package dotenv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Input       string
+		Expectation map[string]string
+		Error       string
+	}{
+		{
+			Name:        "unquoted",
+			Input:       "FOO=bar\nBAZ =  spaced out  \nEMPTY=\n",
+			Expectation: map[string]string{"FOO": "bar", "BAZ": "spaced out", "EMPTY": ""},
+		},
+		{
+			Name:        "export prefix",
+			Input:       "export FOO=bar\nexport\tBAR=baz",
+			Expectation: map[string]string{"FOO": "bar", "BAR": "baz"},
+		},
+		{
+			Name:        "comments",
+			Input:       "# comment\nFOO=bar # comment\nBAR=a#b\n  # indented comment\n",
+			Expectation: map[string]string{"FOO": "bar", "BAR": "a#b"},
+		},
+		{
+			Name:        "single quotes are literal",
+			Input:       `FOO='a\nb "c" $d # e'`,
+			Expectation: map[string]string{"FOO": `a\nb "c" $d # e`},
+		},
+		{
+			Name:        "single quotes span lines",
+			Input:       "FOO='line 1\nline 2'\nBAR=baz",
+			Expectation: map[string]string{"FOO": "line 1\nline 2", "BAR": "baz"},
+		},
+		{
+			Name:        "double quote escapes",
+			Input:       `FOO="a\nb\tc\r\"d\" \\ \$e \x # f"`,
+			Expectation: map[string]string{"FOO": "a\nb\tc\r\"d\" \\ $e \\x # f"},
+		},
+		{
+			Name:        "double quotes span lines",
+			Input:       "FOO=\"line 1\nline 2\" # comment\nBAR=baz",
+			Expectation: map[string]string{"FOO": "line 1\nline 2", "BAR": "baz"},
+		},
+		{
+			Name:        "CRLF",
+			Input:       "FOO=bar\r\nBAR=\"a\r\nb\"\r\n",
+			Expectation: map[string]string{"FOO": "bar", "BAR": "a\nb"},
+		},
+		{
+			Name:  "unterminated single quote",
+			Input: "FOO=bar\nBAR='baz\n",
+			Error: "unterminated single-quoted value starting on line 2",
+		},
+		{
+			Name:  "unterminated double quote",
+			Input: "FOO=\"bar\\\"",
+			Error: "unterminated double-quoted value starting on line 1",
+		},
+		{
+			Name:  "characters after quoted value",
+			Input: `FOO="bar" baz`,
+			Error: "unexpected characters after the value of FOO",
+		},
+		{
+			Name:  "missing assignment",
+			Input: "FOO=bar\nBAR\n",
+			Error: "line 2: expected NAME=value",
+		},
+		{
+			Name:  "invalid name",
+			Input: "1FOO=bar",
+			Error: `invalid variable name "1FOO"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act, err := Parse(strings.NewReader(test.Input))
+			if test.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.Error) {
+					t.Fatalf("expected error containing %q, got %v", test.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(act, test.Expectation) {
+				t.Errorf("unexpected result: got %q, expected %q", act, test.Expectation)
+			}
+		})
+	}
+}
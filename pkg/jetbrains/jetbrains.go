@@ -0,0 +1,351 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package jetbrains
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+)
+
+// BackendMount is where the backend is mounted in the workspace
+const BackendMount = "/ide-desktop/backend"
+
+// Products maps the IDE names used in the .gitpod.yml to JetBrains product codes
+var Products = map[string]string{
+	"intellij": "IIU",
+	"goland":   "GO",
+	"pycharm":  "PCP",
+	"phpstorm": "PS",
+	"rubymine": "RM",
+	"webstorm": "WS",
+	"rider":    "RD",
+	"clion":    "CL",
+}
+
+// IsProduct returns true if the IDE name refers to a JetBrains product
+func IsProduct(ide string) bool {
+	_, ok := Products[ide]
+	return ok
+}
+
+// ConfiguredProducts returns the products which have a section in the jetbrains config of the .gitpod.yml
+func ConfiguredProducts(cfg *gitpod.JetBrains) []string {
+	if cfg == nil {
+		return nil
+	}
+
+	var res []string
+	for name, p := range map[string]*gitpod.JetBrainsProduct{
+		"intellij": cfg.IntelliJ,
+		"goland":   cfg.GoLand,
+		"pycharm":  cfg.PyCharm,
+		"phpstorm": cfg.PhpStorm,
+	} {
+		if p != nil {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Plugins returns the plugins the .gitpod.yml asks for when using a product
+func Plugins(cfg *gitpod.JetBrains, product string) []string {
+	if cfg == nil {
+		return nil
+	}
+
+	res := append([]string{}, cfg.Plugins...)
+	var p *gitpod.JetBrainsProduct
+	switch product {
+	case "intellij":
+		p = cfg.IntelliJ
+	case "goland":
+		p = cfg.GoLand
+	case "pycharm":
+		p = cfg.PyCharm
+	case "phpstorm":
+		p = cfg.PhpStorm
+	}
+	if p != nil {
+		res = append(res, p.Plugins...)
+	}
+	return res
+}
+
+// GatewayURL produces a link which opens JetBrains Gateway and connects to the backend through SSH
+func GatewayURL(sshPort int, projectPath string) string {
+	params := url.Values{
+		"type":        []string{"ssh"},
+		"deploy":      []string{"false"},
+		"host":        []string{"localhost"},
+		"port":        []string{fmt.Sprint(sshPort)},
+		"user":        []string{"gitpod"},
+		"projectPath": []string{projectPath},
+		"idePath":     []string{BackendMount},
+	}
+	return "jetbrains-gateway://connect#" + params.Encode()
+}
+
+// DefaultCacheDir returns the directory backends are downloaded to
+func DefaultCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "run-gp", "jetbrains"), nil
+}
+
+// Release is a downloadable backend release
+type Release struct {
+	Version string
+	Build   string
+	URL     string
+}
+
+// LatestRelease asks JetBrains for the latest release of a product
+func LatestRelease(ctx context.Context, product string) (*Release, error) {
+	code, ok := Products[product]
+	if !ok {
+		return nil, fmt.Errorf("unknown JetBrains product: %s", product)
+	}
+
+	u := "https://data.services.jetbrains.com/products/releases?type=release&latest=true&code=" + url.QueryEscape(code)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot discover latest %s release: %s", product, resp.Status)
+	}
+
+	var releases map[string][]struct {
+		Version   string `json:"version"`
+		Build     string `json:"build"`
+		Downloads map[string]struct {
+			Link string `json:"link"`
+		} `json:"downloads"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&releases)
+	if err != nil {
+		return nil, err
+	}
+	rels := releases[code]
+	if len(rels) == 0 {
+		return nil, fmt.Errorf("no %s release found", product)
+	}
+
+	platform := "linux"
+	if runtime.GOARCH == "arm64" {
+		platform = "linuxARM64"
+	}
+	dl, ok := rels[0].Downloads[platform]
+	if !ok || dl.Link == "" {
+		return nil, fmt.Errorf("%s %s is not available for %s", product, rels[0].Version, platform)
+	}
+
+	return &Release{
+		Version: rels[0].Version,
+		Build:   rels[0].Build,
+		URL:     dl.Link,
+	}, nil
+}
+
+// updateInterval is how often Provision looks for a new release of a backend
+const updateInterval = 24 * time.Hour
+
+// Provision makes sure the latest backend of a product is available in the cache directory and returns its location.
+// Backends are downloaded only once, and we look for new releases at most once a day. If the latest release
+// cannot be discovered, e.g. because we're offline, the most recent backend in the cache is used.
+func Provision(ctx context.Context, cacheDir, product string) (backendDir string, err error) {
+	code, ok := Products[product]
+	if !ok {
+		return "", fmt.Errorf("unknown JetBrains product: %s", product)
+	}
+
+	cached := newestCached(cacheDir, code)
+	if cached != "" {
+		// the modification time of a backend records when we last made sure it's the latest
+		if stat, err := os.Stat(cached); err == nil && time.Since(stat.ModTime()) < updateInterval {
+			return cached, nil
+		}
+	}
+
+	rel, err := LatestRelease(ctx, product)
+	if err != nil {
+		if cached != "" {
+			return cached, nil
+		}
+		return "", err
+	}
+
+	backendDir = filepath.Join(cacheDir, code+"-"+rel.Build)
+	if _, err := os.Stat(backendDir); err == nil {
+		now := time.Now()
+		_ = os.Chtimes(backendDir, now, now)
+		return backendDir, nil
+	}
+
+	err = os.MkdirAll(cacheDir, 0755)
+	if err != nil {
+		return "", err
+	}
+	tmpdir := backendDir + ".tmp"
+	_ = os.RemoveAll(tmpdir)
+	defer os.RemoveAll(tmpdir)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rel.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot download %s: %s", rel.URL, resp.Status)
+	}
+
+	err = extract(resp.Body, tmpdir)
+	if err != nil {
+		return "", fmt.Errorf("cannot extract %s: %w", rel.URL, err)
+	}
+	err = os.Rename(tmpdir, backendDir)
+	if err != nil {
+		return "", err
+	}
+	return backendDir, nil
+}
+
+// newestCached returns the backend of a product with the highest build number in the cache, if there is one
+func newestCached(cacheDir, code string) string {
+	cached, _ := filepath.Glob(filepath.Join(cacheDir, code+"-*"))
+	sort.Strings(cached)
+	for i := len(cached) - 1; i >= 0; i-- {
+		if strings.HasSuffix(cached[i], ".tmp") {
+			continue
+		}
+		return cached[i]
+	}
+	return ""
+}
+
+// extract extracts a gzipped tarball, stripping the top-level directory
+func extract(r io.Reader, dest string) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		segs := strings.SplitN(filepath.ToSlash(filepath.Clean(hdr.Name)), "/", 2)
+		if len(segs) < 2 {
+			continue
+		}
+		rel := segs[1]
+		if rel == ".." || strings.HasPrefix(rel, "../") || filepath.IsAbs(rel) {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+		fn := filepath.Join(dest, filepath.FromSlash(rel))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeSymlink:
+		default:
+			continue
+		}
+
+		// earlier entries may be symlinks, which we must not follow out of dest
+		err = os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			return err
+		}
+		parent, err := filepath.EvalSymlinks(filepath.Dir(fn))
+		if err != nil {
+			return err
+		}
+		if !within(root, parent) {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+		fn = filepath.Join(parent, filepath.Base(fn))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(fn, 0755)
+		case tar.TypeReg:
+			if fi, lerr := os.Lstat(fn); lerr == nil && fi.Mode()&os.ModeSymlink != 0 {
+				return fmt.Errorf("invalid path in archive: %s overwrites a symlink", hdr.Name)
+			}
+			err = writeFile(fn, tr, os.FileMode(hdr.Mode).Perm())
+		case tar.TypeSymlink:
+			target := filepath.FromSlash(hdr.Linkname)
+			if filepath.IsAbs(target) || !within(root, filepath.Join(parent, target)) {
+				return fmt.Errorf("invalid symlink in archive: %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			err = os.Symlink(target, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// within returns true if fn is dir or inside of it. Both paths must be clean.
+func within(dir, fn string) bool {
+	rel, err := filepath.Rel(dir, fn)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func writeFile(fn string, r io.Reader, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(fn), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package opener
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// EnvOpenCommand overrides the command used to open URLs. The URL is passed as last argument.
+const EnvOpenCommand = "RUNGP_OPEN_COMMAND"
+
+// Open opens a URL using the default application of the host, e.g. the browser for http URLs
+// or VS Code for vscode:// URLs.
+func Open(url string) error {
+	var command []string
+	if c := strings.Fields(os.Getenv(EnvOpenCommand)); len(c) > 0 {
+		command = c
+	} else {
+		switch runtime.GOOS {
+		case "darwin":
+			command = []string{"open"}
+		case "windows":
+			command = []string{"rundll32", "url.dll,FileProtocolHandler"}
+		default:
+			command = []string{"xdg-open"}
+		}
+	}
+
+	out, err := exec.Command(command[0], append(command[1:], url)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot open %s using %s: %w: %s", url, command[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
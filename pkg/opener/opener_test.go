@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package opener
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub open command is a shell script")
+	}
+
+	tests := []struct {
+		Name        string
+		Script      string
+		Args        string
+		URL         string
+		Expectation string
+		Error       string
+	}{
+		{
+			Name:        "passes the URL as last argument",
+			Script:      `echo "$@" > "$(dirname "$0")/out"`,
+			Args:        "--new-window",
+			URL:         "https://3000--workspace.localhost",
+			Expectation: "--new-window https://3000--workspace.localhost\n",
+		},
+		{
+			Name:   "reports the output of a failing command",
+			Script: `echo "no browser" >&2; exit 1`,
+			URL:    "vscode://vscode-remote/ssh-remote+workspace/workspace",
+			Error:  "no browser",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			script := filepath.Join(dir, "open.sh")
+			err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"+test.Script+"\n"), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv(EnvOpenCommand, strings.TrimSpace(script+" "+test.Args))
+
+			err = Open(test.URL)
+			if test.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.Error) {
+					t.Fatalf("expected error containing %q, got %v", test.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			act, err := ioutil.ReadFile(filepath.Join(dir, "out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(act) != test.Expectation {
+				t.Errorf("unexpected arguments: got %q, expected %q", act, test.Expectation)
+			}
+		})
+	}
+}
+
+func TestOpenDefaultCommandMissing(t *testing.T) {
+	t.Setenv(EnvOpenCommand, "")
+	t.Setenv("PATH", t.TempDir())
+
+	err := Open("https://example.com")
+	if err == nil {
+		t.Fatal("expected an error if the default open command does not exist")
+	}
+}
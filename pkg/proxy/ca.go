@@ -0,0 +1,207 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	caCertFN = "ca.pem"
+	caKeyFN  = "ca-key.pem"
+)
+
+// CA is the local certificate authority run-gp uses to issue certificates
+// for the HTTPS proxy.
+type CA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// DefaultCADir returns the directory the local CA is stored in
+func DefaultCADir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "run-gp", "ca"), nil
+}
+
+// LoadOrCreateCA loads the CA from dir, or creates a new one if none exists yet
+func LoadOrCreateCA(dir string) (*CA, error) {
+	certFN, keyFN := filepath.Join(dir, caCertFN), filepath.Join(dir, caKeyFN)
+
+	certPEM, err := ioutil.ReadFile(certFN)
+	if os.IsNotExist(err) {
+		return createCA(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyFN)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA key: %w", err)
+	}
+
+	certBlk, _ := pem.Decode(certPEM)
+	if certBlk == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded certificate", certFN)
+	}
+	cert, err := x509.ParseCertificate(certBlk.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse CA certificate: %w", err)
+	}
+	keyBlk, _ := pem.Decode(keyPEM)
+	if keyBlk == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded key", keyFN)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlk.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse CA key: %w", err)
+	}
+
+	return &CA{cert: cert, key: key, pem: certPEM}, nil
+}
+
+func createCA(dir string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"run-gp local CA"},
+			CommonName:   fmt.Sprintf("run-gp CA (%s)", hostname),
+		},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, caKeyFN), keyPEM, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, caCertFN), certPEM, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{cert: cert, key: key, pem: certPEM}, nil
+}
+
+// CertificatePEM returns the PEM encoded CA certificate, e.g. to install it in a trust store
+func (ca *CA) CertificatePEM() []byte {
+	return ca.pem
+}
+
+// Issue produces a short-lived serving certificate for the given DNS names and IP addresses
+func (ca *CA) Issue(hosts []string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"run-gp"},
+			CommonName:   hosts[0],
+		},
+		NotBefore:   time.Now().Add(-1 * time.Hour),
+		NotAfter:    time.Now().AddDate(0, 0, 30),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tpl.IPAddresses = append(tpl.IPAddresses, ip)
+		} else {
+			tpl.DNSNames = append(tpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+	}, nil
+}
+
+// LocalHosts returns the names and addresses under which this machine is likely reached
+func LocalHosts() []string {
+	res := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		res = append(res, hostname)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return res
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		res = append(res, ipnet.IP.String())
+	}
+	return res
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+)
+
+// Target resolves the address (host:port) requests are forwarded to
+type Target func(ctx context.Context) (addr string, err error)
+
+// CachedTarget resolves the target once and remembers the result after it succeeded
+func CachedTarget(t Target) Target {
+	var (
+		mu   sync.Mutex
+		addr string
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if addr != "" {
+			return addr, nil
+		}
+
+		res, err := t(ctx)
+		if err != nil {
+			return "", err
+		}
+		addr = res
+		return addr, nil
+	}
+}
+
+// ListenTLS produces a listener which terminates TLS using the certificate
+func ListenTLS(addr string, cert *tls.Certificate) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(l, &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		MinVersion:   tls.VersionTLS12,
+	}), nil
+}
+
+// ListenTLSWithCA produces a listener which terminates TLS using certificates issued by the CA
+// for whatever server name the client asks for.
+func ListenTLSWithCA(addr string, ca *CA) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu    sync.Mutex
+		certs = make(map[string]*tls.Certificate)
+	)
+	return tls.NewListener(l, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = "localhost"
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if c, ok := certs[name]; ok {
+				return c, nil
+			}
+			c, err := ca.Issue([]string{name})
+			if err != nil {
+				return nil, err
+			}
+			certs[name] = c
+			return c, nil
+		},
+	}), nil
+}
+
+// Serve forwards all HTTP requests (including websocket upgrades) received on l to the target.
+// Serve returns once the context is canceled.
+func Serve(ctx context.Context, l net.Listener, target Target) error {
+	return serve(ctx, l, func(r *http.Request) (string, error) {
+		return target(r.Context())
+	})
+}
+
+func serve(ctx context.Context, l net.Listener, resolve func(r *http.Request) (string, error)) error {
+	rp := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			addr, err := resolve(r)
+			if err != nil {
+				console.Default.Debugf("cannot resolve proxy target for %s: %v", r.Host, err)
+				// an empty host makes the transport fail, which ends up in the error handler
+				addr = ""
+			}
+			r.URL.Scheme = "http"
+			r.URL.Host = addr
+			if r.TLS != nil {
+				r.Header.Set("X-Forwarded-Proto", "https")
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			console.Default.Debugf("proxy error for %s%s: %v", r.Host, r.URL.Path, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	srv := &http.Server{
+		Handler:           rp,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	err := srv.Serve(l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
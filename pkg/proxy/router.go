@@ -0,0 +1,128 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
+)
+
+// IDEPort is the container port serving the IDE
+const IDEPort = 22999
+
+// PortResolver finds the host address a workspace port is reachable at
+type PortResolver func(ctx context.Context, workspaceID string, port int) (addr string, err error)
+
+// WorkspaceURL returns the URL of a workspace served by the router
+func WorkspaceURL(scheme, workspaceID string, proxyPort int) string {
+	return fmt.Sprintf("%s://%s.localhost:%d", scheme, workspaceID, proxyPort)
+}
+
+// PortURL returns the URL of a workspace port served by the router
+func PortURL(scheme, workspaceID string, port, proxyPort int) string {
+	return fmt.Sprintf("%s://%d-%s.localhost:%d", scheme, port, workspaceID, proxyPort)
+}
+
+// PortURLTemplate returns the URL of all workspace ports served by the router, with {port} in place of the port
+func PortURLTemplate(scheme, workspaceID string, proxyPort int) string {
+	return fmt.Sprintf("%s://{port}-%s.localhost:%d", scheme, workspaceID, proxyPort)
+}
+
+// portHostPattern matches the hosts of workspace ports. Workspace IDs never start with a digit,
+// hence they cannot be mistaken for a port.
+var portHostPattern = regexp.MustCompile(`^(\d+)-([a-z][a-z0-9-]*)$`)
+
+// parseHost splits a host of the form <port>-<workspace>.localhost or <workspace>.localhost
+func parseHost(host string) (workspaceID string, port int, err error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if !strings.HasSuffix(host, ".localhost") {
+		return "", 0, fmt.Errorf("%s is not a workspace host", host)
+	}
+	label := strings.TrimSuffix(host, ".localhost")
+	if strings.Contains(label, ".") {
+		return "", 0, fmt.Errorf("%s is not a workspace host", host)
+	}
+
+	if m := portHostPattern.FindStringSubmatch(label); m != nil {
+		port, err := strconv.Atoi(m[1])
+		if err != nil {
+			return "", 0, err
+		}
+		return m[2], port, nil
+	}
+	return label, IDEPort, nil
+}
+
+// ServeRouter serves all workspaces and their ports on a single address, routing requests
+// by their host: <workspace>.localhost is the IDE, <port>-<workspace>.localhost is a workspace port.
+//
+// Several run-gp instances can share the same address: routing only depends on the runtime,
+// hence whoever manages to bind the address serves all workspaces. Instances which cannot bind
+// keep trying until the context is canceled.
+func ServeRouter(ctx context.Context, addr string, listen func(addr string) (net.Listener, error), resolve PortResolver) {
+	type cacheEntry struct {
+		addr    string
+		expires time.Time
+	}
+	var (
+		mu    sync.Mutex
+		cache = make(map[string]cacheEntry)
+	)
+	route := func(r *http.Request) (string, error) {
+		mu.Lock()
+		e, ok := cache[r.Host]
+		mu.Unlock()
+		if ok && time.Now().Before(e.expires) {
+			return e.addr, nil
+		}
+
+		ws, port, err := parseHost(r.Host)
+		if err != nil {
+			return "", err
+		}
+		target, err := resolve(r.Context(), ws, port)
+		if err != nil {
+			return "", err
+		}
+
+		mu.Lock()
+		cache[r.Host] = cacheEntry{addr: target, expires: time.Now().Add(10 * time.Second)}
+		mu.Unlock()
+		return target, nil
+	}
+
+	for {
+		l, err := listen(addr)
+		if err == nil {
+			console.Default.Debugf("serving workspace proxy on %s", addr)
+			err = serve(ctx, l, route)
+			if err != nil {
+				console.Default.Warnf("workspace proxy failed: %v", err)
+			}
+		} else if !errors.Is(err, syscall.EADDRINUSE) {
+			console.Default.Warnf("cannot serve workspace proxy on %s: %v", addr, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDockerSidecarImage is the image of the Docker daemon of a workspace unless configured otherwise
+	DefaultDockerSidecarImage = "docker:dind"
+	// DockerSocketDir is where the socket of the Docker daemon is mounted in the workspace
+	DockerSocketDir = "/run/rungp-docker"
+	// DockerHost points the Docker CLI in the workspace at the Docker daemon of the workspace
+	DockerHost = "unix://" + DockerSocketDir + "/docker.sock"
+
+	dockerSidecarStartTimeout = 2 * time.Minute
+)
+
+// DockerSidecar runs a Docker daemon for a workspace in a separate container, isolated from the
+// Docker daemon of the host. The daemon shares the network of the workspace, so that ports of
+// containers started in the workspace are available on localhost, and keeps its images in a volume.
+type DockerSidecar struct {
+	// Image of the Docker daemon. Defaults to DefaultDockerSidecarImage.
+	Image string
+	// GID is the group allowed to use the Docker daemon, i.e. the group of the gitpod user
+	GID int
+}
+
+// DockerSidecarName returns the name of the container running the Docker daemon of a workspace
+func DockerSidecarName(workspaceID string) string {
+	return ContainerName(workspaceID) + "-docker"
+}
+
+// dockerSocketVolume shares the socket of the Docker daemon with the workspace
+func dockerSocketVolume(workspaceID string) Volume {
+	return Volume{
+		Name:   VolumeName(workspaceID, "docker-socket"),
+		Target: DockerSocketDir,
+		Labels: map[string]string{LabelWorkspaceID: workspaceID},
+	}
+}
+
+// runDockerSidecar starts the Docker daemon of a workspace once the workspace container is running.
+// The daemon joins the network namespace of the workspace, hence cannot start earlier.
+func (dr docker) runDockerSidecar(ctx context.Context, logs io.Writer, workspaceID string, sidecar DockerSidecar) error {
+	image := sidecar.Image
+	if image == "" {
+		image = DefaultDockerSidecarImage
+	}
+	storage := WorkspaceVolume(workspaceID, "docker", "/var/lib/docker")
+	err := dr.EnsureVolume(ctx, storage)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dockerSidecarStartTimeout)
+	defer cancel()
+	workspace := ContainerName(workspaceID)
+	for {
+		out, _ := exec.CommandContext(ctx, dr.Command, "inspect", "--format", "{{.State.Running}}", workspace).Output()
+		if strings.TrimSpace(string(out)) == "true" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("workspace did not start: %w", ctx.Err())
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	socket := dockerSocketVolume(workspaceID)
+	args := []string{"run", "--rm", "--detach", "--privileged",
+		"--name", DockerSidecarName(workspaceID),
+		"--label", LabelWorkspaceID + "=" + workspaceID,
+		"--network", "container:" + workspace,
+		"-e", "DOCKER_TLS_CERTDIR=",
+		"-v", fmt.Sprintf("%s:%s", storage.Name, storage.Target),
+		"-v", fmt.Sprintf("%s:%s", socket.Name, socket.Target),
+		image,
+		"dockerd", "--host", DockerHost, "--group", strconv.Itoa(sidecar.GID),
+	}
+	out, err := exec.CommandContext(ctx, dr.Command, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	fmt.Fprintf(logs, "started Docker daemon %s\n", DockerSidecarName(workspaceID))
+	return nil
+}
+
+// stopDockerSidecar tears down the Docker daemon of a workspace. Its storage volume is kept for the next start.
+func (dr docker) stopDockerSidecar(workspaceID string) {
+	exec.Command(dr.Command, "rm", "--force", DockerSidecarName(workspaceID)).Run()
+	exec.Command(dr.Command, "volume", "rm", dockerSocketVolume(workspaceID).Name).Run()
+}
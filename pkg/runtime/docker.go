@@ -5,21 +5,32 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/bridge"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
 	"github.com/gitpod-io/gitpod/run-gp/pkg/runtime/assets"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/state"
 	"github.com/gitpod-io/gitpod/run-gp/pkg/telemetry"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/vsx"
 )
 
 type docker struct {
@@ -32,7 +43,7 @@ func (dr docker) Name() string {
 }
 
 // BuildImage builds the workspace image
-func (dr docker) BuildImage(ctx context.Context, logs io.WriteCloser, ref string, cfg *gitpod.GitpodConfig) (err error) {
+func (dr docker) BuildImage(ctx context.Context, logs io.WriteCloser, ref string, cfg *gitpod.GitpodConfig, opts BuildOpts) (err error) {
 	tmpdir, err := os.MkdirTemp("", "rungp-*")
 	if err != nil {
 		return err
@@ -48,6 +59,7 @@ func (dr docker) BuildImage(ctx context.Context, logs io.WriteCloser, ref string
 	var (
 		assetsHeader string
 		assetsCmds   string
+		gpCmd        string
 	)
 	if assets.IsEmbedded() {
 		err := assets.Extract(tmpdir)
@@ -58,34 +70,39 @@ func (dr docker) BuildImage(ctx context.Context, logs io.WriteCloser, ref string
 		COPY supervisor/ /.supervisor/
 		COPY ide/ /ide/
 		`
+		// asset packs built before gp was added don't contain it
+		if _, err := os.Stat(filepath.Join(tmpdir, "gp", "gp")); err == nil {
+			gpCmd = "COPY gp/gp /usr/bin/gp\n"
+		}
 	} else {
 		return fmt.Errorf("missing assets - please make sure you ran go:generate before")
 	}
 
-	var baseimage string
-	switch img := cfg.Image.(type) {
-	case nil:
-		baseimage = "FROM gitpod/workspace-full:latest"
-	case string:
-		baseimage = "FROM " + img
-	case map[string]interface{}:
-		fc, err := json.Marshal(img)
+	// the environment variables of the embedded assets point to VS Code
+	assetsEnv := assetEnvVars(assets.ImageEnvVars())
+	if opts.IDE != nil {
+		header, ideCmds, err := layerIDE(tmpdir, opts.IDE)
 		if err != nil {
 			return err
 		}
-		var obj gitpod.Image_object
-		err = json.Unmarshal(fc, &obj)
-		if err != nil {
-			return err
-		}
-		fc, err = ioutil.ReadFile(filepath.Join(dr.Workdir, obj.Context, obj.File))
-		if err != nil {
-			// TODO(cw): make error actionable
-			return err
-		}
-		baseimage = "\n" + string(fc) + "\n"
-	default:
-		return fmt.Errorf("unsupported image: %v", img)
+		assetsHeader = header
+		assetsCmds = "COPY supervisor/ /.supervisor/\n" + ideCmds
+		assetsEnv = nil
+	}
+
+	helperCmds, err := layerHelpers(tmpdir)
+	if err != nil {
+		return err
+	}
+	assetsCmds += helperCmds + gpCmd
+
+	ref, dockerfile, err := configuredImage(dr.Workdir, cfg)
+	if err != nil {
+		return err
+	}
+	baseimage := "FROM " + ref
+	if dockerfile != nil {
+		baseimage = "\n" + string(dockerfile) + "\n"
 	}
 
 	df := `
@@ -95,10 +112,11 @@ func (dr docker) BuildImage(ctx context.Context, logs io.WriteCloser, ref string
 
 	USER root
 	RUN rm /usr/bin/gp-vncsession || true
-	RUN mkdir -p /workspace && \
+	RUN mkdir -p ` + IDEDataDir + ` && \
 		chown -R 33333:33333 /workspace
-	`
-	df += strings.Join(assetEnvVars(assets.ImageEnvVars()), "\n")
+	` + safeDirectoryCmd(path.Join("/workspace", cfg.CheckoutLocation)) + `
+	` + cacheDirsCmd(opts.CacheDirs)
+	df += strings.Join(assetsEnv, "\n")
 
 	fmt.Fprintf(logs, "\nDockerfile:%s\n", df)
 
@@ -164,42 +182,123 @@ func (dr docker) StartWorkspace(ctx context.Context, workspaceImage string, cfg
 		return fmt.Errorf("missing workspace location")
 	}
 
-	name := fmt.Sprintf("rungp-%d", time.Now().UnixNano())
-	args := []string{"run", "--rm", "--user", "root", "--privileged", "-p", fmt.Sprintf("%d:22999", opts.IDEPort), "-v", fmt.Sprintf("%s:%s", dr.Workdir, filepath.Join("/workspace", cfg.CheckoutLocation)), "--name", name}
+	publish := func(hostPort, containerPort int) string {
+		if opts.PublishOnLoopback {
+			return fmt.Sprintf("127.0.0.1::%d", containerPort)
+		}
+		return fmt.Sprintf("%d:%d", hostPort, containerPort)
+	}
+
+	if opts.WorkspaceID == "" {
+		opts.WorkspaceID = WorkspaceID(dr.Workdir)
+	}
+	if opts.WorkspaceURL == "" {
+		opts.WorkspaceURL = "http://localhost"
+	}
+
+	name := ContainerName(opts.WorkspaceID)
+	args := []string{"run", "--rm", "--user", "root", "-p", publish(opts.IDEPort, 22999), "-v", fmt.Sprintf("%s:%s", dr.Workdir, filepath.Join("/workspace", cfg.CheckoutLocation)), "--name", name,
+		"--label", LabelWorkspaceID + "=" + opts.WorkspaceID,
+		"--label", LabelWorkdir + "=" + dr.Workdir,
+	}
+
+	securityArgs, err := dr.securityArgs(opts.SecurityProfile, opts.DockerSidecar == nil)
+	if err != nil {
+		return err
+	}
+	args = append(args, securityArgs...)
+
+	if opts.IDEAlias == "" {
+		opts.IDEAlias = "code"
+	}
+	for _, m := range opts.Mounts {
+		args = append(args, dr.mountArgs(m)...)
+	}
+	containerArgs, err := dr.containerArgs(opts.Container)
+	if err != nil {
+		return err
+	}
+	args = append(args, containerArgs...)
+	for _, v := range opts.Volumes {
+		err = dr.EnsureVolume(ctx, v)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-v", fmt.Sprintf("%s:%s", v.Name, v.Target))
+	}
+	if opts.DockerSidecar != nil {
+		socket := dockerSocketVolume(opts.WorkspaceID)
+		err = dr.EnsureVolume(ctx, socket)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-v", fmt.Sprintf("%s:%s", socket.Name, socket.Target))
+		go func(sidecar DockerSidecar) {
+			err := dr.runDockerSidecar(ctx, logs, opts.WorkspaceID, sidecar)
+			if err != nil {
+				fmt.Fprintf(logs, "cannot start Docker daemon: %v\n", err)
+			}
+		}(*opts.DockerSidecar)
+	}
 
-	if (runtime.GOOS == "darwin" || runtime.GOOS == "linux") && dr.Command == "docker" {
-		args = append(args, "-v", "/var/run/docker.sock:/var/run/docker.sock")
+	stateDir, err := StateDir(opts.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	err = state.Prepare(stateDir)
+	if err != nil {
+		return fmt.Errorf("cannot prepare workspace state: %w", err)
+	}
+	err = prepareTaskState(stateDir)
+	if err != nil {
+		return fmt.Errorf("cannot prepare workspace state: %w", err)
 	}
+	args = append(args, "-v", fmt.Sprintf("%s:%s", state.Shared(stateDir), StateDirMount))
 
-	tasks, err := json.Marshal(cfg.Tasks)
+	tasks, err := json.Marshal(instrumentTasks(cfg.Tasks))
 	if err != nil {
 		return err
 	}
 
 	envs := map[string]string{
-		"GITPOD_WORKSPACE_URL":           "http://localhost",
+		"GITPOD_WORKSPACE_URL":           opts.WorkspaceURL,
 		"GITPOD_THEIA_PORT":              "23000",
-		"GITPOD_IDE_ALIAS":               "code",
+		"GITPOD_IDE_ALIAS":               opts.IDEAlias,
 		"THEIA_WORKSPACE_ROOT":           filepath.Join("/workspace", cfg.WorkspaceLocation),
 		"GITPOD_REPO_ROOT":               filepath.Join("/workspace", cfg.CheckoutLocation),
 		"GITPOD_PREVENT_METADATA_ACCESS": "false",
-		"GITPOD_WORKSPACE_ID":            "a-random-name",
+		"GITPOD_WORKSPACE_ID":            opts.WorkspaceID,
 		"GITPOD_TASKS":                   string(tasks),
 		"GITPOD_HEADLESS":                "false",
 		"GITPOD_HOST":                    "gitpod.local",
 		"THEIA_SUPERVISOR_TOKENS":        `{"token": "invalid","kind": "gitpod","host": "gitpod.local","scope": [],"expiryDate": ` + time.Now().Format(time.RFC3339) + `,"reuse": 2}`,
-		"VSX_REGISTRY_URL":               "https://https://open-vsx.org/",
+		"VSX_REGISTRY_URL":               vsx.Registry{URL: opts.VSXRegistryURL}.BaseURL(),
+	}
+	if opts.DockerSidecar != nil {
+		envs["DOCKER_HOST"] = DockerHost
+	}
+	if opts.HostBridgeURL != "" {
+		envs[bridge.EnvURL] = opts.HostBridgeURL
+		envs[bridge.EnvToken] = opts.HostBridgeToken
+		envs["BROWSER"] = BrowserHelper
+		envs["GP_EXTERNAL_BROWSER"] = BrowserHelper
+		envs["GP_PREVIEW_BROWSER"] = BrowserHelper
+		if opts.HostGateway != "" {
+			// Docker Desktop provides host.docker.internal, on Linux we have to add it ourselves
+			args = append(args, "--add-host", bridge.Host+":"+opts.HostGateway)
+		}
+	}
+	for k, v := range opts.Env {
+		envs[k] = v
+	}
+	envArgs, envSetup, envFiles, err := passEnv(envs)
+	for _, fn := range envFiles {
+		defer os.Remove(fn)
 	}
-	tmpf, err := ioutil.TempFile("", "rungp-*.env")
 	if err != nil {
 		return err
 	}
-	for k, v := range envs {
-		tmpf.WriteString(fmt.Sprintf("%s=%s\n", k, v))
-	}
-	tmpf.Close()
-	args = append(args, "--env-file", tmpf.Name())
-	defer os.Remove(tmpf.Name())
+	args = append(args, envArgs...)
 
 	if opts.SSHPublicKey != "" {
 		tmpf, err := ioutil.TempFile("", "rungp-*.pub")
@@ -217,22 +316,45 @@ func (dr docker) StartWorkspace(ctx context.Context, workspaceImage string, cfg
 
 	if !opts.NoPortForwarding {
 		for _, p := range cfg.Ports {
-			args = append(args, "-p", fmt.Sprintf("%d:%d", p.Port.(int)+opts.PortOffset, p.Port))
+			args = append(args, "-p", publish(p.Port.(int)+opts.PortOffset, p.Port.(int)))
 		}
 	}
 
 	args = append(args, workspaceImage)
-	args = append(args, "/.supervisor/supervisor", "run", "--rungp")
+	startCmd := taskStateCmd(cfg.Tasks) + " && exec /.supervisor/supervisor run --rungp"
+	if envSetup != "" {
+		startCmd = envSetup + " && " + startCmd
+	}
+	args = append(args, "/bin/sh", "-c", startCmd)
 
 	if telemetry.Enabled() {
 		telemetry.RecordWorkspaceStarted(telemetry.GetGitRemoteOriginURI(dr.Workdir), dr.Command)
 	}
 
+	if opts.FileOwner != nil {
+		// a workspace which did not stop cleanly left its files behind
+		dr.handBackFiles(logs, workspaceImage, *opts.FileOwner)
+	}
+
 	cmd := exec.Command(dr.Command, args...)
 	cmd.Dir = dr.Workdir
 	cmd.Stdout = logs
 	cmd.Stderr = logs
 
+	// teardown runs when the workspace stops by itself, and when it is stopped because the context is canceled
+	var teardownOnce sync.Once
+	teardown := func() {
+		teardownOnce.Do(func() {
+			if opts.DockerSidecar != nil {
+				dr.stopDockerSidecar(opts.WorkspaceID)
+			}
+			if opts.FileOwner != nil {
+				dr.handBackFiles(logs, workspaceImage, *opts.FileOwner)
+			}
+		})
+	}
+	defer teardown()
+
 	go func() {
 		<-ctx.Done()
 		if cmd.Process != nil {
@@ -240,6 +362,7 @@ func (dr docker) StartWorkspace(ctx context.Context, workspaceImage string, cfg
 		}
 
 		exec.Command(dr.Command, "kill", name).CombinedOutput()
+		teardown()
 
 		if err != nil && telemetry.Enabled() {
 			telemetry.RecordWorkspaceFailure(telemetry.GetGitRemoteOriginURI(dr.Workdir), "start", dr.Command)
@@ -248,3 +371,232 @@ func (dr docker) StartWorkspace(ctx context.Context, workspaceImage string, cfg
 
 	return cmd.Run()
 }
+
+// mountArgs translates a mount into the flags of the container runtime
+func (dr docker) mountArgs(m Mount) []string {
+	if dr.Command == "nerdctl" {
+		v := fmt.Sprintf("%s:%s", m.Source, m.Target)
+		if m.ReadOnly {
+			v += ":ro"
+		}
+		return []string{"-v", v}
+	}
+
+	// --mount fails if the source doesn't exist, rather than creating it. Its value is CSV, hence we let
+	// the CSV writer quote the fields.
+	fields := []string{"type=bind", "source=" + m.Source, "target=" + m.Target}
+	if m.ReadOnly {
+		fields = append(fields, "readonly")
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(fields)
+	w.Flush()
+	return []string{"--mount", strings.TrimSuffix(buf.String(), "\n")}
+}
+
+// strictCapabilities are the capabilities supervisor needs to run the IDE and tasks as the gitpod user
+var strictCapabilities = []string{"CHOWN", "DAC_OVERRIDE", "FOWNER", "KILL", "SETGID", "SETUID"}
+
+// securityArgs translates a security profile into the flags of the container runtime.
+// Privileged workspaces get access to the Docker daemon of the host if hostDocker is true.
+func (dr docker) securityArgs(profile string, hostDocker bool) ([]string, error) {
+	switch profile {
+	case config.SecurityProfileStrict:
+		args := []string{"--cap-drop", "ALL", "--security-opt", "no-new-privileges"}
+		for _, c := range strictCapabilities {
+			args = append(args, "--cap-add", c)
+		}
+		return args, nil
+	case "", config.SecurityProfileDefault:
+		return nil, nil
+	case config.SecurityProfilePrivileged:
+		args := []string{"--privileged"}
+		if hostDocker && (runtime.GOOS == "darwin" || runtime.GOOS == "linux") && dr.Command == "docker" {
+			args = append(args, "-v", "/var/run/docker.sock:/var/run/docker.sock")
+		}
+		return args, nil
+	default:
+		return nil, config.ValidateSecurityProfile(profile)
+	}
+}
+
+// containerArgs translates the container config of a project into the flags of the container runtime
+func (dr docker) containerArgs(c config.ContainerConfig) ([]string, error) {
+	err := c.ValidateRuntime(dr.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	for _, m := range c.Mounts {
+		src, err := m.SourcePath(dr.Workdir)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, dr.mountArgs(Mount{Source: src, Target: m.Target, ReadOnly: m.ReadOnly})...)
+	}
+	for _, d := range c.Devices {
+		args = append(args, "--device", d)
+	}
+	for _, capability := range c.Capabilities {
+		args = append(args, "--cap-add", strings.TrimPrefix(strings.ToUpper(capability), "CAP_"))
+	}
+	sysctls := make([]string, 0, len(c.Sysctls))
+	for k, v := range c.Sysctls {
+		sysctls = append(sysctls, k+"="+v)
+	}
+	sort.Strings(sysctls)
+	for _, s := range sysctls {
+		args = append(args, "--sysctl", s)
+	}
+	args = append(args, c.Args...)
+	args = append(args, c.RuntimeArgs[dr.Command]...)
+	return args, nil
+}
+
+// envScriptMount is where the script which exports multi-line environment variables is mounted in the workspace
+const envScriptMount = "/.rungp-env.sh"
+
+// shellName matches the environment variable names a POSIX shell can export
+var shellName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// passEnv passes the environment variables to the container. Values go into an env file, except for multi-line
+// values which env files cannot represent. Those go into a script which the container sources before starting
+// supervisor, so that no value of the workspace ever ends up in the environment of the runtime CLI.
+// It returns the arguments for the runtime CLI, the command which sources the script if there is one, and the
+// temporary files the caller must remove once the container has started.
+func passEnv(envs map[string]string) (args []string, setup string, files []string, err error) {
+	envFile, err := ioutil.TempFile("", "rungp-*.env")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer envFile.Close()
+	files = append(files, envFile.Name())
+
+	names := make([]string, 0, len(envs))
+	for k := range envs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var script strings.Builder
+	for _, k := range names {
+		v := envs[k]
+		if k == "" || strings.ContainsAny(k, "= \t\r\n") {
+			return nil, "", files, fmt.Errorf("invalid environment variable name %q", k)
+		}
+		if !strings.ContainsAny(v, "\r\n") {
+			_, err = fmt.Fprintf(envFile, "%s=%s\n", k, v)
+			if err != nil {
+				return nil, "", files, err
+			}
+			continue
+		}
+		if !shellName.MatchString(k) {
+			return nil, "", files, fmt.Errorf("environment variable %s cannot have a multi-line value", k)
+		}
+		fmt.Fprintf(&script, "export %s='%s'\n", k, strings.ReplaceAll(v, "'", `'\''`))
+	}
+	args = append(args, "--env-file", envFile.Name())
+	if script.Len() == 0 {
+		return args, "", files, nil
+	}
+
+	scriptFile, err := ioutil.TempFile("", "rungp-*.sh")
+	if err != nil {
+		return nil, "", files, err
+	}
+	files = append(files, scriptFile.Name())
+	_, err = scriptFile.WriteString(script.String())
+	if cerr := scriptFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, "", files, err
+	}
+	args = append(args, "-v", scriptFile.Name()+":"+envScriptMount+":ro")
+	return args, ". " + envScriptMount, files, nil
+}
+
+// ClaimContainerName makes sure a container name is available. It fails if a running container uses the name,
+// and removes a stopped container which does, e.g. one left behind by a workspace which did not shut down cleanly.
+func (dr docker) ClaimContainerName(ctx context.Context, name string) error {
+	out, err := exec.CommandContext(ctx, dr.Command, "inspect", "--type", "container", "--format", "{{.State.Running}}", name).Output()
+	if err != nil {
+		// there is no such container
+		return nil
+	}
+	if strings.TrimSpace(string(out)) == "true" {
+		return fmt.Errorf("container %s is already running: the workspace of this working directory can only run once, stop the other run-gp first", name)
+	}
+	out, err = exec.CommandContext(ctx, dr.Command, "rm", "--force", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot remove stopped container %s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// HostGateway returns the gateway of the default bridge network on Linux. Docker Desktop provides
+// host.docker.internal itself.
+func (dr docker) HostGateway(ctx context.Context) (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", nil
+	}
+	out, err := exec.CommandContext(ctx, dr.Command, "network", "inspect", "bridge", "--format", "{{range .IPAM.Config}}{{.Gateway}} {{end}}").Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot inspect the bridge network: %w", err)
+	}
+	for _, gw := range strings.Fields(string(out)) {
+		if ip := net.ParseIP(gw); ip != nil && ip.To4() != nil {
+			return gw, nil
+		}
+	}
+	return "", fmt.Errorf("the bridge network has no IPv4 gateway")
+}
+
+// PublishedPort returns the host address a container port was published on
+func (dr docker) PublishedPort(ctx context.Context, container string, port int) (addr string, err error) {
+	out, err := exec.CommandContext(ctx, dr.Command, "port", container, fmt.Sprintf("%d/tcp", port)).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("cannot find published port %d of %s: %s", port, container, strings.TrimSpace(string(out)))
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// ports published on all interfaces are reachable on loopback
+		for _, prefix := range []string{"0.0.0.0:", "[::]:", ":::"} {
+			if strings.HasPrefix(line, prefix) {
+				line = "127.0.0.1:" + strings.TrimPrefix(line, prefix)
+				break
+			}
+		}
+		return line, nil
+	}
+	return "", fmt.Errorf("port %d of %s is not published", port, container)
+}
+
+// Exec runs a command in a running container
+func (dr docker) Exec(ctx context.Context, container string, command []string, opts ExecOpts) error {
+	args := []string{"exec"}
+	if opts.Stdin != nil {
+		args = append(args, "-i")
+	}
+	if opts.TTY {
+		args = append(args, "-t")
+	}
+	if opts.User != "" {
+		args = append(args, "-u", opts.User)
+	}
+	args = append(args, container)
+	args = append(args, command...)
+
+	cmd := exec.CommandContext(ctx, dr.Command, args...)
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	return cmd.Run()
+}
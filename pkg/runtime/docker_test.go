@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPassEnv(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Envs    map[string]string
+		EnvFile string
+		Script  string
+		Error   string
+	}{
+		{
+			Name:    "single-line values go into the env file",
+			Envs:    map[string]string{"FOO": "bar", "BAZ": "a=b"},
+			EnvFile: "BAZ=a=b\nFOO=bar\n",
+		},
+		{
+			Name:    "multi-line values go into the script",
+			Envs:    map[string]string{"FOO": "bar", "CERT": "line 1\nline 2", "CRLF": "a\r\nb"},
+			EnvFile: "FOO=bar\n",
+			Script:  "export CERT='line 1\nline 2'\nexport CRLF='a\r\nb'\n",
+		},
+		{
+			Name:    "quotes in multi-line values are escaped",
+			Envs:    map[string]string{"FOO": "it's\n$(true)"},
+			EnvFile: "",
+			Script:  "export FOO='it'\\''s\n$(true)'\n",
+		},
+		{
+			Name:    "multi-line DOCKER_ values stay out of the runtime CLI",
+			Envs:    map[string]string{"DOCKER_HOST": "unix:///a\nunix:///b"},
+			EnvFile: "",
+			Script:  "export DOCKER_HOST='unix:///a\nunix:///b'\n",
+		},
+		{
+			Name:  "multi-line values need a shell name",
+			Envs:  map[string]string{"FOO.BAR": "a\nb"},
+			Error: "environment variable FOO.BAR cannot have a multi-line value",
+		},
+		{
+			Name:  "invalid name",
+			Envs:  map[string]string{"FOO BAR": "baz"},
+			Error: `invalid environment variable name "FOO BAR"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			args, setup, files, err := passEnv(test.Envs)
+			for _, fn := range files {
+				defer os.Remove(fn)
+			}
+			if test.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.Error) {
+					t.Fatalf("expected error containing %q, got %v", test.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(args) < 2 || args[0] != "--env-file" {
+				t.Fatalf("unexpected args: %q", args)
+			}
+			fc, err := ioutil.ReadFile(args[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(fc) != test.EnvFile {
+				t.Errorf("unexpected env file: got %q, expected %q", fc, test.EnvFile)
+			}
+
+			if test.Script == "" {
+				if len(args) != 2 || setup != "" {
+					t.Errorf("unexpected script: args %q, setup %q", args, setup)
+				}
+				return
+			}
+			if len(args) != 4 || args[2] != "-v" || !strings.HasSuffix(args[3], ":"+envScriptMount+":ro") {
+				t.Fatalf("unexpected args: %q", args)
+			}
+			if setup != ". "+envScriptMount {
+				t.Errorf("unexpected setup command: %q", setup)
+			}
+			scriptFile := strings.TrimSuffix(args[3], ":"+envScriptMount+":ro")
+			stat, err := os.Stat(scriptFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Mode().Perm() != 0600 {
+				t.Errorf("unexpected script permissions: %v", stat.Mode().Perm())
+			}
+			fc, err = ioutil.ReadFile(scriptFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(fc) != test.Script {
+				t.Errorf("unexpected script: got %q, expected %q", fc, test.Script)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package runtime
+
+import (
+	"embed"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// HelpersDir is where the run-gp helpers are installed in the workspace
+	HelpersDir = "/usr/local/bin"
+	// BrowserHelper opens URLs in the browser of the host
+	BrowserHelper = HelpersDir + "/run-gp-browser"
+)
+
+//go:embed helpers
+var helpers embed.FS
+
+// layerHelpers adds the run-gp helpers to the build context and returns the Dockerfile instructions which install them
+func layerHelpers(buildCtx string) (cmds string, err error) {
+	dst := filepath.Join(buildCtx, "helpers")
+	err = os.MkdirAll(dst, 0755)
+	if err != nil {
+		return "", err
+	}
+	err = fs.WalkDir(helpers, "helpers", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fc, err := helpers.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dst, d.Name()), fc, 0755)
+	})
+	if err != nil {
+		return "", err
+	}
+	return "COPY helpers/ " + HelpersDir + "/\n", nil
+}
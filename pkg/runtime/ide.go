@@ -0,0 +1,125 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
+)
+
+// supervisorIDEConfig is the IDE config supervisor reads from /ide/supervisor-ide-config.json
+type supervisorIDEConfig struct {
+	Entrypoint     string                    `json:"entrypoint"`
+	EntrypointArgs []string                  `json:"entrypointArgs"`
+	ReadinessProbe *supervisorReadinessProbe `json:"readinessProbe,omitempty"`
+}
+
+type supervisorReadinessProbe struct {
+	Type string               `json:"type"`
+	HTTP *supervisorHTTPProbe `json:"http,omitempty"`
+}
+
+type supervisorHTTPProbe struct {
+	Path string `json:"path"`
+}
+
+// layerIDE prepares the build context so that a user-defined IDE replaces the embedded VS Code.
+// It returns the Dockerfile instructions which go before the base image, and those which copy the IDE into the image.
+func layerIDE(buildCtx string, ide *config.IDEConfig) (header, cmds string, err error) {
+	err = ide.Validate()
+	if err != nil {
+		return "", "", err
+	}
+
+	ideCfg := supervisorIDEConfig{
+		Entrypoint:     ide.Entrypoint,
+		EntrypointArgs: ide.Args,
+	}
+	if rc := ide.ReadinessCheck; rc != nil {
+		ideCfg.ReadinessProbe = &supervisorReadinessProbe{Type: rc.Type}
+		if rc.Type == "http" {
+			ideCfg.ReadinessProbe.HTTP = &supervisorHTTPProbe{Path: rc.Path}
+		}
+	}
+	fc, err := json.MarshalIndent(ideCfg, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+	err = os.MkdirAll(filepath.Join(buildCtx, "ide-config"), 0755)
+	if err != nil {
+		return "", "", err
+	}
+	err = ioutil.WriteFile(filepath.Join(buildCtx, "ide-config", "supervisor-ide-config.json"), fc, 0644)
+	if err != nil {
+		return "", "", err
+	}
+
+	if ide.Image != "" {
+		path := ide.Path
+		if path == "" {
+			path = "/ide"
+		}
+		header = "FROM " + ide.Image + " AS ide"
+		cmds = fmt.Sprintf("COPY --from=ide --chown=33333:33333 %s/ /ide/\n", strings.TrimSuffix(path, "/"))
+	} else {
+		err = copyDir(ide.Dir, filepath.Join(buildCtx, "ide-custom"))
+		if err != nil {
+			return "", "", fmt.Errorf("cannot copy IDE %s from %s: %w", ide.Name, ide.Dir, err)
+		}
+		cmds = "COPY --chown=33333:33333 ide-custom/ /ide/\n"
+	}
+	cmds += "COPY --chown=33333:33333 ide-config/supervisor-ide-config.json /ide/supervisor-ide-config.json\n"
+
+	return header, cmds, nil
+}
+
+// copyDir recursively copies a directory, preserving file modes and symlinks
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			in, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, in)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		default:
+			return nil
+		}
+	})
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+)
+
+// configuredImage resolves the image configured in the .gitpod.yml. It returns either the image reference,
+// or the content of the Dockerfile the image is built from.
+func configuredImage(workdir string, cfg *gitpod.GitpodConfig) (ref string, dockerfile []byte, err error) {
+	switch img := cfg.Image.(type) {
+	case nil:
+		return DefaultImage, nil, nil
+	case string:
+		return img, nil, nil
+	case map[string]interface{}:
+		fc, err := json.Marshal(img)
+		if err != nil {
+			return "", nil, err
+		}
+		var obj gitpod.Image_object
+		err = json.Unmarshal(fc, &obj)
+		if err != nil {
+			return "", nil, err
+		}
+		fn := filepath.Join(workdir, obj.Context, obj.File)
+		dockerfile, err = ioutil.ReadFile(fn)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot read the Dockerfile configured in .gitpod.yml (image.file is resolved relative to image.context): %w", err)
+		}
+		return "", dockerfile, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported image: %v", img)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"os/exec"
 
 	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/config"
 	"github.com/gitpod-io/gitpod/run-gp/pkg/console"
 )
 
@@ -62,17 +63,122 @@ type RuntimeBuilder interface {
 
 type Runtime interface {
 	StartWorkspace(ctx context.Context, imageRef string, cfg *gitpod.GitpodConfig, opts StartOpts) error
+
+	// ClaimContainerName makes sure a container name is available. It fails if a running container uses the name,
+	// and removes a stopped container which does.
+	ClaimContainerName(ctx context.Context, name string) error
+
+	// HostGateway returns the address of this machine on the network of the workspace containers,
+	// or an empty string if the runtime makes the machine available as host.docker.internal itself
+	HostGateway(ctx context.Context) (string, error)
+
+	// PublishedPort returns the host address a container port was published on
+	PublishedPort(ctx context.Context, container string, port int) (addr string, err error)
+
+	// Exec runs a command in a running container
+	Exec(ctx context.Context, container string, command []string, opts ExecOpts) error
+
+	// EnsureVolume creates a named volume unless it exists
+	EnsureVolume(ctx context.Context, vol Volume) error
+	// ListVolumes lists the named volumes which carry a label
+	ListVolumes(ctx context.Context, label string) ([]VolumeInfo, error)
+	// RemoveVolume removes a named volume. Volumes which are in use cannot be removed.
+	RemoveVolume(ctx context.Context, name string) error
+}
+
+type ExecOpts struct {
+	// User runs the command as this user. Defaults to the container's user.
+	User   string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	TTY    bool
 }
 
+// Mount makes a host path available in the workspace
+type Mount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// Volume mounts a named volume into the workspace. The runtime creates the volume if it doesn't exist.
+type Volume struct {
+	Name   string
+	Target string
+	// Labels are set when the volume is created
+	Labels map[string]string
+}
+
+const (
+	// IDEDataDir is where VS Code keeps its server data, settings and extensions in the workspace
+	IDEDataDir = "/workspace/.vscode-remote"
+	// HomeDir is the home directory of the gitpod user
+	HomeDir = "/home/gitpod"
+)
+
 type Builder interface {
-	BuildImage(ctx context.Context, logs io.WriteCloser, ref string, cfg *gitpod.GitpodConfig) (err error)
+	BuildImage(ctx context.Context, logs io.WriteCloser, ref string, cfg *gitpod.GitpodConfig, opts BuildOpts) (err error)
+}
+
+type BuildOpts struct {
+	// IDE replaces the embedded VS Code if set
+	IDE *config.IDEConfig
+
+	// CacheDirs are the container paths of cache volumes. They're created in the image so that they belong to
+	// the gitpod user.
+	CacheDirs []string
 }
 
 type StartOpts struct {
+	// WorkspaceID identifies the workspace, see WorkspaceID(). The container is named after it.
+	WorkspaceID string
+
+	// WorkspaceURL is the URL the workspace is reachable at. Defaults to http://localhost.
+	WorkspaceURL string
+
+	// PublishOnLoopback publishes the IDE and workspace ports on random loopback ports
+	// instead of IDEPort and the port offset. Use PublishedPort to find those ports.
+	PublishOnLoopback bool
+
 	PortOffset       int
 	NoPortForwarding bool
 	IDEPort          int
 	SSHPort          int
 	SSHPublicKey     string
 	Logs             io.WriteCloser
+
+	// IDEAlias names the IDE the user works with, e.g. code or intellij
+	IDEAlias string
+
+	// VSXRegistryURL is the Open VSX registry the IDE installs extensions from
+	VSXRegistryURL string
+
+	// Mounts are additional mounts for the workspace container
+	Mounts []Mount
+
+	// Volumes are named volumes for the workspace container
+	Volumes []Volume
+
+	// SecurityProfile is strict, default or privileged. Defaults to default.
+	SecurityProfile string
+
+	// FileOwner gets the files the workspace created in the working directory when the workspace starts and
+	// stops, if set. Processes in the workspace keep running as the gitpod user.
+	FileOwner *UserMapping
+
+	// DockerSidecar runs a Docker daemon for the workspace instead of sharing the host's, if set
+	DockerSidecar *DockerSidecar
+
+	// Container adds mounts, devices, capabilities and runtime args from the project config. It must be valid.
+	Container config.ContainerConfig
+
+	// Env are additional environment variables for the workspace, e.g. the user's
+	Env map[string]string
+
+	// HostBridgeURL and HostBridgeToken let the workspace reach the host bridge, if set
+	HostBridgeURL   string
+	HostBridgeToken string
+	// HostGateway is the address of this machine on the network of the workspace, see Runtime.HostGateway
+	HostGateway string
 }
@@ -0,0 +1,121 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package runtime
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+	"github.com/gitpod-io/gitpod/run-gp/pkg/state"
+)
+
+// StateDirMount is where the shared workspace state directory is mounted in the workspace
+const StateDirMount = state.Mount
+
+// StateDir returns the host directory which holds the state of a workspace.
+// Only its shared subdirectory is mounted into the workspace, see state.Shared.
+func StateDir(workspaceID string) (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "run-gp", "workspaces", workspaceID), nil
+}
+
+// prepareTaskState creates the directory the tasks record their state in. The workspace resets it when it starts,
+// see taskStateCmd. Only the host user can reach it, because the state directory is private.
+func prepareTaskState(stateDir string) error {
+	dir := filepath.Join(state.Shared(stateDir), "tasks")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	// root in the workspace is not the host user if the container runtime uses user namespaces
+	return os.Chmod(dir, 0777)
+}
+
+// taskStateCmd produces the shell command which resets the task state when the workspace starts.
+// It runs as root, and only the gitpod user which runs the tasks may record their state.
+func taskStateCmd(tasks []*gitpod.TasksItems) string {
+	dir := path.Join(StateDirMount, "tasks")
+	cmd := "rm -rf " + dir + "/*"
+	if len(tasks) == 0 {
+		return cmd
+	}
+	dirs := make([]string, 0, len(tasks))
+	for i := range tasks {
+		dirs = append(dirs, path.Join(dir, strconv.Itoa(i)))
+	}
+	td := strings.Join(dirs, " ")
+	return cmd + " && mkdir " + td + " && chown 33333:33333 " + td + " && chmod 0755 " + td
+}
+
+// instrumentTasks makes the tasks record their phase (before, init, command) and exit code in the state directory
+func instrumentTasks(tasks []*gitpod.TasksItems) []*gitpod.TasksItems {
+	res := make([]*gitpod.TasksItems, 0, len(tasks))
+	for i, t := range tasks {
+		if t == nil {
+			res = append(res, t)
+			continue
+		}
+
+		nt := *t
+		sections := []struct {
+			Phase  string
+			Script *string
+		}{
+			{"before", &nt.Before},
+			{"init", &nt.Init},
+			{"command", &nt.Command},
+		}
+		last := -1
+		for j, s := range sections {
+			if strings.TrimSpace(*s.Script) != "" {
+				last = j
+			}
+		}
+
+		dir := path.Join(StateDirMount, "tasks", strconv.Itoa(i))
+		for j, s := range sections {
+			if strings.TrimSpace(*s.Script) == "" {
+				continue
+			}
+
+			// A failing section ends the task, hence we record its exit code.
+			// The last section always records its exit code.
+			cond := `[ $__rungp_rc -ne 0 ] && `
+			if j == last {
+				cond = ""
+			}
+			*s.Script = fmt.Sprintf("printf %s > %s/phase 2>/dev/null\n%s\n__rungp_rc=$?; %sprintf '%%d' $__rungp_rc > %s/exit 2>/dev/null; (exit $__rungp_rc)",
+				s.Phase, dir,
+				*s.Script,
+				cond, dir,
+			)
+		}
+		res = append(res, &nt)
+	}
+	return res
+}
+
+// TaskProgress reads the phase and exit code the i-th task recorded in the shared state directory
+func TaskProgress(stateDir string, i int) (phase string, exitCode int, exited bool) {
+	dir := filepath.Join(state.Shared(stateDir), "tasks", strconv.Itoa(i))
+	if fc, err := ioutil.ReadFile(filepath.Join(dir, "phase")); err == nil {
+		phase = strings.TrimSpace(string(fc))
+	}
+	if fc, err := ioutil.ReadFile(filepath.Join(dir, "exit")); err == nil {
+		if code, err := strconv.Atoi(strings.TrimSpace(string(fc))); err == nil {
+			exitCode, exited = code, true
+		}
+	}
+	return
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// GitpodUID and GitpodGID are the IDs of the gitpod user in workspace images
+	GitpodUID = 33333
+	GitpodGID = 33333
+)
+
+// UserMapping maps the gitpod user to a user on the host
+type UserMapping struct {
+	UID int
+	GID int
+}
+
+// HostUserMapping maps the gitpod user to the user running run-gp. This is only necessary on Linux: Docker Desktop
+// translates the ownership of bind mounts itself. Supervisor runs the IDE, tasks and terminals with the fixed IDs
+// of the gitpod user, hence the mapping cannot change the IDs processes in the workspace run with.
+func HostUserMapping() (*UserMapping, error) {
+	if runtime.GOOS != "linux" {
+		return nil, nil
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		return nil, fmt.Errorf("cannot map the gitpod user to root")
+	}
+	if uid == GitpodUID && gid == GitpodGID {
+		return nil, nil
+	}
+	return &UserMapping{UID: uid, GID: gid}, nil
+}
+
+// safeDirectoryCmd produces the Dockerfile instructions which make git in the workspace trust the checkout,
+// which belongs to the host user rather than the gitpod user on Linux
+func safeDirectoryCmd(checkout string) string {
+	quoted := "'" + strings.ReplaceAll(checkout, "'", `'\''`) + "'"
+	return `RUN if command -v git >/dev/null; then git config --system --add safe.directory ` + quoted + `; fi
+`
+}
+
+// handBackFiles hands the files the gitpod user created in the working directory to the host user.
+// It runs in a separate container because the workspace container is gone by the time the workspace stopped, and
+// it runs when the workspace starts too, for the files of a workspace which did not stop cleanly.
+func (dr docker) handBackFiles(logs io.Writer, workspaceImage string, m UserMapping) {
+	out, err := exec.Command(dr.Command, "run", "--rm", "--user", "root", "--network", "none",
+		"-v", dr.Workdir+":/rungp-workdir", "--entrypoint", "find", workspaceImage,
+		"/rungp-workdir", "-xdev", "(", "-uid", strconv.Itoa(GitpodUID), "-o", "-gid", strconv.Itoa(GitpodGID), ")",
+		"-exec", "chown", "-h", fmt.Sprintf("%d:%d", m.UID, m.GID), "{}", "+",
+	).CombinedOutput()
+	if err != nil {
+		fmt.Fprintf(logs, "cannot hand the files in %s back to user %d: %v: %s\n", dr.Workdir, m.UID, err, strings.TrimSpace(string(out)))
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	gitpod "github.com/gitpod-io/gitpod/gitpod-protocol"
+)
+
+const (
+	// LabelCache marks the volumes which hold package and build caches
+	LabelCache = "io.gitpod.rungp.cache"
+	// LabelCacheImage is the volume label carrying the base image a cache belongs to
+	LabelCacheImage = "io.gitpod.rungp.cache.image"
+	// LabelCachePath is the volume label carrying the path a cache is mounted at
+	LabelCachePath = "io.gitpod.rungp.cache.path"
+	// LabelCacheRepository is the volume label carrying the repository a cache belongs to, if it isn't shared
+	LabelCacheRepository = "io.gitpod.rungp.cache.repository"
+
+	// DefaultImage is the workspace image used if the .gitpod.yml does not configure one
+	DefaultImage = "gitpod/workspace-full:latest"
+)
+
+// VolumeInfo describes a named volume
+type VolumeInfo struct {
+	Name      string
+	Labels    map[string]string
+	CreatedAt string
+}
+
+// reservedCachePaths hold the system, the IDE and the workspace content. Caches must not be any of these,
+// inside of one, or contain one. The same goes for the home directory itself and everything run-gp mounts at /.rungp*.
+var reservedCachePaths = []string{
+	"/bin", "/boot", "/dev", "/etc", "/ide", "/lib", "/lib32", "/lib64", "/libx32", "/proc", "/root", "/run",
+	"/sbin", "/sys", "/usr", "/var", "/workspace", "/.supervisor",
+}
+
+// cachePathExceptions are inside of reserved paths, but fine as caches
+var cachePathExceptions = []string{"/var/cache", "/var/tmp"}
+
+// CachePath validates the container path of a cache and expands ~ to the home directory of the gitpod user
+func CachePath(p string) (string, error) {
+	switch {
+	case p == "~":
+		p = HomeDir
+	case strings.HasPrefix(p, "~/"):
+		p = path.Join(HomeDir, p[2:])
+	}
+	if !path.IsAbs(p) {
+		return "", fmt.Errorf("invalid cache path %q: must be absolute or start with ~/", p)
+	}
+	p = path.Clean(p)
+
+	if isWithin(HomeDir, p) {
+		return "", fmt.Errorf("invalid cache path %q: must not be or contain the home directory", p)
+	}
+	if isWithin(p, HomeDir) {
+		return p, nil
+	}
+	for _, e := range cachePathExceptions {
+		if isWithin(p, e) {
+			return p, nil
+		}
+	}
+	if strings.HasPrefix(p, StateDirMount) {
+		return "", fmt.Errorf("invalid cache path %q: %s* is reserved for run-gp", p, StateDirMount)
+	}
+	for _, r := range reservedCachePaths {
+		if isWithin(p, r) || isWithin(r, p) {
+			return "", fmt.Errorf("invalid cache path %q: must not be, contain or be inside of %s", p, r)
+		}
+	}
+	return p, nil
+}
+
+// isWithin returns true if p is dir or inside of it. Both paths must be clean.
+func isWithin(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// BaseImage identifies the base image of a workspace, i.e. the image or the Dockerfile configured in the .gitpod.yml.
+// Dockerfiles are identified by their content.
+func BaseImage(workdir string, cfg *gitpod.GitpodConfig) (string, error) {
+	ref, dockerfile, err := configuredImage(workdir, cfg)
+	if err != nil {
+		return "", err
+	}
+	if dockerfile != nil {
+		return fmt.Sprintf("dockerfile:%x", sha256.Sum256(dockerfile)), nil
+	}
+	return ref, nil
+}
+
+// CacheVolume returns the volume which holds the cache at a container path for a base image.
+// Workspaces with the same base image share their caches. If repository is set, only the workspaces of
+// that repository share the cache, which is what caches declared by projects use.
+func CacheVolume(baseImage, repository, containerPath string) Volume {
+	hash := sha256.Sum256([]byte(baseImage + "\x00" + repository + "\x00" + containerPath))
+	labels := map[string]string{
+		LabelCache:      "true",
+		LabelCacheImage: baseImage,
+		LabelCachePath:  containerPath,
+	}
+	if repository != "" {
+		labels[LabelCacheRepository] = repository
+	}
+	return Volume{
+		Name:   fmt.Sprintf("rungp-cache-%x", hash[:6]),
+		Target: containerPath,
+		Labels: labels,
+	}
+}
+
+// cacheDirsCmd produces the Dockerfile instructions which create the cache directories in the image, owned by
+// the gitpod user. Volumes copy the ownership of the directory they're mounted on, hence without this the caches
+// would belong to root.
+func cacheDirsCmd(dirs []string) string {
+	if len(dirs) == 0 {
+		return ""
+	}
+	quoted := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		quoted = append(quoted, "'"+strings.ReplaceAll(d, "'", `'\''`)+"'")
+	}
+	return `RUN for d in ` + strings.Join(quoted, " ") + `; do \
+		n=""; p="$d"; while [ ! -e "$p" ]; do n="$p"; p="$(dirname "$p")"; done; \
+		mkdir -p "$d" && chown 33333:33333 "$d" && if [ -n "$n" ]; then chown -R 33333:33333 "$n"; fi; \
+	done
+`
+}
+
+// EnsureVolume creates a named volume unless it exists
+func (dr docker) EnsureVolume(ctx context.Context, vol Volume) error {
+	if err := exec.CommandContext(ctx, dr.Command, "volume", "inspect", vol.Name).Run(); err == nil {
+		return nil
+	}
+
+	args := []string{"volume", "create"}
+	labels := make([]string, 0, len(vol.Labels))
+	for k, v := range vol.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		args = append(args, "--label", l)
+	}
+	args = append(args, vol.Name)
+	out, err := exec.CommandContext(ctx, dr.Command, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot create volume %s: %w: %s", vol.Name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ListVolumes lists the named volumes which carry a label
+func (dr docker) ListVolumes(ctx context.Context, label string) ([]VolumeInfo, error) {
+	out, err := exec.CommandContext(ctx, dr.Command, "volume", "ls", "--quiet", "--filter", "label="+label).Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list volumes: %w", err)
+	}
+	names := strings.Fields(string(out))
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	out, err = exec.CommandContext(ctx, dr.Command, append([]string{"volume", "inspect"}, names...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot inspect volumes: %w", err)
+	}
+	var res []VolumeInfo
+	err = json.NewDecoder(bytes.NewReader(out)).Decode(&res)
+	if err != nil {
+		return nil, fmt.Errorf("cannot inspect volumes: %w", err)
+	}
+	return res, nil
+}
+
+// RemoveVolume removes a named volume. Volumes which are in use cannot be removed.
+func (dr docker) RemoveVolume(ctx context.Context, name string) error {
+	out, err := exec.CommandContext(ctx, dr.Command, "volume", "rm", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot remove volume %s: %s", name, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
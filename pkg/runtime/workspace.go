@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package runtime
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// LabelWorkspaceID is the container label carrying the workspace ID
+	LabelWorkspaceID = "io.gitpod.rungp.workspace"
+	// LabelWorkdir is the container label carrying the host working directory of a workspace
+	LabelWorkdir = "io.gitpod.rungp.workdir"
+	// LabelVolume marks the volumes which keep workspace data. Its value is the purpose of the volume.
+	LabelVolume = "io.gitpod.rungp.volume"
+)
+
+// idSeparators are replaced by a single hyphen in workspace IDs
+var idSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// WorkspaceID produces a stable workspace ID for a working directory.
+// The ID is a valid DNS label so that it can be used in workspace URLs. It never starts with a digit,
+// hence the hosts of workspace ports, <port>-<workspace>, are unambiguous.
+func WorkspaceID(workdir string) string {
+	base := strings.ToLower(filepath.Base(workdir))
+	base = strings.Trim(idSeparators.ReplaceAllString(base, "-"), "-")
+	if len(base) > 40 {
+		base = strings.TrimRight(base[:40], "-")
+	}
+	if base == "" {
+		base = "workspace"
+	}
+	if base[0] >= '0' && base[0] <= '9' {
+		base = "ws-" + base
+	}
+
+	hash := sha256.Sum256([]byte(workdir))
+	return fmt.Sprintf("%s-%x", base, hash[:3])
+}
+
+// ContainerName returns the name of the container running a workspace
+func ContainerName(workspaceID string) string {
+	return "rungp-" + workspaceID
+}
+
+// ImageName returns the name of the image a workspace runs. Every workspace has its own image,
+// so that workspaces which build at the same time don't run each other's image.
+func ImageName(workspaceID string) string {
+	return ContainerName(workspaceID) + ":latest"
+}
+
+// VolumeName returns the name of a named volume which keeps workspace data across restarts.
+// If workspaceID is empty, the volume is shared by all workspaces.
+func VolumeName(workspaceID, purpose string) string {
+	if workspaceID == "" {
+		return "rungp-" + purpose
+	}
+	return ContainerName(workspaceID) + "-" + purpose
+}
+
+// WorkspaceVolume returns the named volume which keeps workspace data across restarts, see VolumeName.
+// The volume is labeled so that it can be listed and removed.
+func WorkspaceVolume(workspaceID, purpose, target string) Volume {
+	labels := map[string]string{LabelVolume: purpose}
+	if workspaceID != "" {
+		labels[LabelWorkspaceID] = workspaceID
+	}
+	return Volume{
+		Name:   VolumeName(workspaceID, purpose),
+		Target: target,
+		Labels: labels,
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package sshconfig
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Identity describes which key to use when connecting to a workspace
+type Identity struct {
+	// File is the private key, or empty if the SSH agent provides the key
+	File string
+}
+
+func (id Identity) String() string {
+	if id.File == "" {
+		return "keys from the SSH agent"
+	}
+	return id.File
+}
+
+// preferredKeys are the key files OpenSSH tries by default, in order
+var preferredKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// GeneratedKeyFile returns the location of the keypair run-gp generates if the user has no SSH keys
+func GeneratedKeyFile(dir string) string {
+	return filepath.Join(dir, "id_ed25519")
+}
+
+// AuthorizedKeys collects the public keys of the user, i.e. all ~/.ssh/*.pub files and the keys the SSH agent holds,
+// and returns them in the authorized_keys format. If there are none, a keypair is generated in dir.
+func AuthorizedKeys(dir string) (authorizedKeys []byte, identity *Identity, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		buf  bytes.Buffer
+		seen = make(map[string]bool)
+		add  = func(key ssh.PublicKey, comment string) {
+			k := string(key.Marshal())
+			if seen[k] {
+				return
+			}
+			seen[k] = true
+			buf.Write(bytes.TrimSpace(ssh.MarshalAuthorizedKey(key)))
+			if comment != "" {
+				buf.WriteString(" " + comment)
+			}
+			buf.WriteString("\n")
+		}
+	)
+
+	agentKeys, _ := listAgentKeys()
+	for _, k := range agentKeys {
+		add(k, k.Comment)
+	}
+	if len(agentKeys) > 0 {
+		identity = &Identity{}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(home, ".ssh", "*.pub"))
+	sort.Slice(files, func(i, j int) bool {
+		return keyPreference(files[i]) < keyPreference(files[j])
+	})
+	for _, fn := range files {
+		key, comment, err := ReadPublicKey(fn)
+		if err != nil {
+			continue
+		}
+		add(key, comment)
+
+		if identity != nil {
+			continue
+		}
+		if privateKeyFN := strings.TrimSuffix(fn, ".pub"); fileExists(privateKeyFN) {
+			identity = &Identity{File: privateKeyFN}
+		}
+	}
+
+	if buf.Len() > 0 && identity != nil {
+		return buf.Bytes(), identity, nil
+	}
+
+	fn := GeneratedKeyFile(dir)
+	if !fileExists(fn) {
+		err = generateKey(fn)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot generate SSH key: %w", err)
+		}
+	}
+	key, comment, err := ReadPublicKey(fn + ".pub")
+	if err != nil {
+		return nil, nil, err
+	}
+	add(key, comment)
+	return buf.Bytes(), &Identity{File: fn}, nil
+}
+
+// ReadPublicKey reads a public key in the authorized_keys format
+func ReadPublicKey(fn string) (key ssh.PublicKey, comment string, err error) {
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, "", err
+	}
+	key, comment, _, _, err = ssh.ParseAuthorizedKey(fc)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot parse public key %s: %w", fn, err)
+	}
+	return key, comment, nil
+}
+
+func keyPreference(fn string) int {
+	name := strings.TrimSuffix(filepath.Base(fn), ".pub")
+	for i, k := range preferredKeys {
+		if k == name {
+			return i
+		}
+	}
+	return len(preferredKeys)
+}
+
+func listAgentKeys() ([]*agent.Key, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return agent.NewClient(conn).List()
+}
+
+func fileExists(fn string) bool {
+	_, err := os.Stat(fn)
+	return err == nil
+}
+
+// generateKey writes an unencrypted ed25519 keypair in the OpenSSH format
+func generateKey(fn string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return err
+	}
+
+	comment := "run-gp"
+	if host, err := os.Hostname(); err == nil {
+		comment += "@" + host
+	}
+
+	var check [4]byte
+	_, err = rand.Read(check[:])
+	if err != nil {
+		return err
+	}
+	privBlock := ssh.Marshal(struct {
+		Check1  uint32
+		Check2  uint32
+		KeyType string
+		Pub     []byte
+		Priv    []byte
+		Comment string
+	}{
+		Check1:  binary.BigEndian.Uint32(check[:]),
+		Check2:  binary.BigEndian.Uint32(check[:]),
+		KeyType: ssh.KeyAlgoED25519,
+		Pub:     pub,
+		Priv:    priv,
+		Comment: comment,
+	})
+	for i := byte(1); len(privBlock)%8 != 0; i++ {
+		privBlock = append(privBlock, i)
+	}
+	key := append([]byte("openssh-key-v1\x00"), ssh.Marshal(struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{
+		CipherName:   "none",
+		KdfName:      "none",
+		NumKeys:      1,
+		PubKey:       sshPub.Marshal(),
+		PrivKeyBlock: privBlock,
+	})...)
+
+	err = os.MkdirAll(filepath.Dir(fn), 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(fn, pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: key}), 0600)
+	if err != nil {
+		return err
+	}
+	pubKey := append(bytes.TrimSpace(ssh.MarshalAuthorizedKey(sshPub)), []byte(" "+comment+"\n")...)
+	return ioutil.WriteFile(fn+".pub", pubKey, 0644)
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package sshconfig
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	hostsDir      = "hosts"
+	knownHostsDir = "known_hosts"
+	hostSuffix    = ".conf"
+)
+
+// DefaultDir returns the directory run-gp maintains its SSH config in
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "run-gp"), nil
+}
+
+// UserConfig returns the location of the user's SSH config
+func UserConfig() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
+
+// HostAlias is the SSH host alias of a workspace
+func HostAlias(workspaceID string) string {
+	return workspaceID + ".run-gp"
+}
+
+// Entry describes how to connect to a workspace using SSH
+type Entry struct {
+	WorkspaceID string
+	Port        int
+	// ProxyCommand connects to the workspace instead of Port, if set
+	ProxyCommand string
+	// IdentityFile is the private key to use, if any
+	IdentityFile string
+}
+
+// KnownHostsFile returns the known_hosts file of a workspace
+func KnownHostsFile(dir, workspaceID string) string {
+	return filepath.Join(dir, knownHostsDir, workspaceID)
+}
+
+// ResetKnownHosts forgets the host key of a workspace. Call it whenever the workspace starts,
+// because the workspace gets a new host key then.
+func ResetKnownHosts(dir, workspaceID string) error {
+	err := os.Remove(KnownHostsFile(dir, workspaceID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Add writes the SSH config entry of a workspace and makes sure the user's SSH config includes it.
+// Every workspace has its own known_hosts file which is reset whenever the entry is written,
+// because the workspace gets a new host key whenever it starts.
+func Add(dir string, e Entry) (alias string, err error) {
+	err = os.MkdirAll(filepath.Join(dir, hostsDir), 0700)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Join(dir, knownHostsDir), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	knownHosts := KnownHostsFile(dir, e.WorkspaceID)
+	err = ResetKnownHosts(dir, e.WorkspaceID)
+	if err != nil {
+		return "", err
+	}
+
+	alias = HostAlias(e.WorkspaceID)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# managed by run-gp - changes will be overwritten\n")
+	fmt.Fprintf(&buf, "Host %s\n", alias)
+	fmt.Fprintf(&buf, "    HostName localhost\n")
+	if e.ProxyCommand != "" {
+		fmt.Fprintf(&buf, "    ProxyCommand %s\n", e.ProxyCommand)
+	} else {
+		fmt.Fprintf(&buf, "    Port %d\n", e.Port)
+	}
+	fmt.Fprintf(&buf, "    User gitpod\n")
+	if e.IdentityFile != "" {
+		fmt.Fprintf(&buf, "    IdentityFile %s\n", quote(e.IdentityFile))
+	}
+	fmt.Fprintf(&buf, "    HostKeyAlias %s\n", alias)
+	fmt.Fprintf(&buf, "    UserKnownHostsFile %s\n", quote(knownHosts))
+	fmt.Fprintf(&buf, "    StrictHostKeyChecking accept-new\n")
+
+	err = ioutil.WriteFile(filepath.Join(dir, hostsDir, e.WorkspaceID+hostSuffix), buf.Bytes(), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	err = ensureInclude(dir)
+	if err != nil {
+		return "", fmt.Errorf("cannot include run-gp entries in SSH config: %w", err)
+	}
+	return alias, nil
+}
+
+// Remove removes the SSH config entry and known hosts of a workspace
+func Remove(dir, workspaceID string) error {
+	for _, fn := range []string{
+		filepath.Join(dir, hostsDir, workspaceID+hostSuffix),
+		KnownHostsFile(dir, workspaceID),
+	} {
+		err := os.Remove(fn)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune removes the entries of all workspaces which are no longer running,
+// e.g. because run-gp did not get to clean up after them.
+func Prune(dir string, running func(workspaceID string) bool) error {
+	entries, err := filepath.Glob(filepath.Join(dir, hostsDir, "*"+hostSuffix))
+	if err != nil {
+		return err
+	}
+	for _, fn := range entries {
+		id := strings.TrimSuffix(filepath.Base(fn), hostSuffix)
+		if running(id) {
+			continue
+		}
+		err = Remove(dir, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureInclude adds an Include for the run-gp entries to the top of the user's SSH config.
+// Include directives apply to the Host block they're in, hence they need to come first.
+func ensureInclude(dir string) error {
+	fn, err := UserConfig()
+	if err != nil {
+		return err
+	}
+	include := "Include " + quote(filepath.Join(dir, hostsDir, "*"+hostSuffix))
+
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(fc), "\n") {
+		if strings.TrimSpace(line) == include {
+			return nil
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(fn), 0700)
+	if err != nil {
+		return err
+	}
+	// the config often is a symlink into a dotfiles repository, which we must not replace
+	if target, err := filepath.EvalSymlinks(fn); err == nil {
+		fn = target
+	}
+	mode := os.FileMode(0600)
+	if stat, err := os.Stat(fn); err == nil {
+		mode = stat.Mode().Perm()
+	}
+	content := "# added by run-gp\n" + include + "\n\n" + string(fc)
+	return writeFileAtomic(fn, []byte(content), mode)
+}
+
+// writeFileAtomic writes a file such that it either has its old or its new content, even if we crash
+// or another run-gp instance writes it at the same time
+func writeFileAtomic(fn string, content []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fn), "."+filepath.Base(fn)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fn)
+}
+
+func quote(s string) string {
+	if !strings.ContainsAny(s, " \t") {
+		return s
+	}
+	return `"` + s + `"`
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+// Package state describes the state run-gp keeps for a workspace, and the part of it run-gp shares with the workspace.
+// It is used by run-gp on the host and by gp in the workspace, hence it must stay free of heavy dependencies.
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mount is where the shared workspace state directory is mounted in the workspace, see Shared
+const Mount = "/.rungp"
+
+const (
+	// sharedDir is the only part of the state directory the workspace gets to see
+	sharedDir = "shared"
+	urlsFile  = "urls.json"
+	// envFile holds the variables set using gp env. It lives in the part of the state directory the workspace
+	// cannot access, gp changes the variables through the host bridge.
+	envFile = "env.json"
+	// legacyEnvFile is where earlier versions kept the variables, in the directory shared with the workspace
+	legacyEnvFile = "gp/env.json"
+)
+
+// URLs describes where the workspace and its ports are reachable from the host
+type URLs struct {
+	// Workspace is the URL of the IDE
+	Workspace string `json:"workspace"`
+	// Ports maps workspace ports to their URL
+	Ports map[int]string `json:"ports,omitempty"`
+	// PortTemplate produces the URL of any port by replacing {port}. It's set if all ports are reachable.
+	PortTemplate string `json:"portTemplate,omitempty"`
+}
+
+// PortURL returns the URL of a workspace port, if the port is reachable from the host
+func (u URLs) PortURL(port int) (string, bool) {
+	if res, ok := u.Ports[port]; ok {
+		return res, true
+	}
+	if u.PortTemplate != "" {
+		return strings.ReplaceAll(u.PortTemplate, "{port}", strconv.Itoa(port)), true
+	}
+	return "", false
+}
+
+// Prepare creates the state directory of a workspace. Only the owner may access it because it holds state
+// which run-gp trusts, e.g. how to open the workspace. The workspace gets the shared subdirectory only.
+func Prepare(dir string) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	// earlier versions shared the whole directory with the workspace
+	err = os.Chmod(dir, 0700)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(Shared(dir), 0755)
+}
+
+// Shared returns the subdirectory of the state directory which is mounted into the workspace, see Mount.
+// run-gp must not trust its content.
+func Shared(dir string) string {
+	return filepath.Join(dir, sharedDir)
+}
+
+// WriteURLs records the workspace URLs in the shared state directory
+func WriteURLs(dir string, urls URLs) error {
+	return writeJSON(filepath.Join(dir, urlsFile), urls, 0644)
+}
+
+// ReadURLs reads the workspace URLs from the shared state directory
+func ReadURLs(dir string) (*URLs, error) {
+	var res URLs
+	err := readJSON(filepath.Join(dir, urlsFile), &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ReadEnv reads the environment variables set using gp env. They're passed to the workspace when it starts.
+func ReadEnv(dir string) (map[string]string, error) {
+	res := make(map[string]string)
+	err := readJSON(filepath.Join(dir, envFile), &res)
+	if os.IsNotExist(err) {
+		err = readJSON(filepath.Join(dir, legacyEnvFile), &res)
+	}
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// WriteEnv stores the environment variables set using gp env
+func WriteEnv(dir string, env map[string]string) error {
+	err := writeJSON(filepath.Join(dir, envFile), env, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(filepath.Join(dir, filepath.Dir(legacyEnvFile)))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func readJSON(fn string, dst interface{}) error {
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(fc, dst)
+}
+
+// writeJSON writes the file atomically so that concurrent readers never see partial content
+func writeJSON(fn string, src interface{}, mode os.FileMode) error {
+	fc, err := json.MarshalIndent(src, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(fn), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fn), "."+filepath.Base(fn)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(fc)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fn)
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package supervisor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIPrefix is the path under which supervisor serves its HTTP API
+const APIPrefix = "/_supervisor/v1"
+
+// Client talks to the HTTP API of the supervisor running in a workspace
+type Client struct {
+	endpoint func(ctx context.Context) (addr string, err error)
+	http     *http.Client
+}
+
+// NewClient produces a new supervisor API client. The endpoint resolves the host address (host:port)
+// supervisor's API port is reachable at.
+func NewClient(endpoint func(ctx context.Context) (addr string, err error)) *Client {
+	return &Client{
+		endpoint: endpoint,
+		http:     &http.Client{},
+	}
+}
+
+// IDEStatus reports whether the IDE is ready. If wait is true the call blocks until it is.
+func (c *Client) IDEStatus(ctx context.Context, wait bool) (ok bool, err error) {
+	path := "/status/ide"
+	if wait {
+		path += "/wait/true"
+	}
+
+	var res struct {
+		OK bool `json:"ok"`
+	}
+	err = c.get(ctx, path, &res)
+	if err != nil {
+		return false, err
+	}
+	return res.OK, nil
+}
+
+// ContentStatus reports whether the workspace content is available. If wait is true the call blocks until it is.
+func (c *Client) ContentStatus(ctx context.Context, wait bool) (available bool, err error) {
+	path := "/status/content"
+	if wait {
+		path += "/wait/true"
+	}
+
+	var res struct {
+		Available bool `json:"available"`
+	}
+	err = c.get(ctx, path, &res)
+	if err != nil {
+		return false, err
+	}
+	return res.Available, nil
+}
+
+// TaskState is the state of a workspace task
+type TaskState string
+
+const (
+	TaskOpening TaskState = "opening"
+	TaskRunning TaskState = "running"
+	TaskClosed  TaskState = "closed"
+)
+
+// UnmarshalJSON accepts both the name and the number of the state
+func (s *TaskState) UnmarshalJSON(data []byte) error {
+	if n, err := strconv.Atoi(string(data)); err == nil {
+		switch n {
+		case 0:
+			*s = TaskOpening
+		case 1:
+			*s = TaskRunning
+		case 2:
+			*s = TaskClosed
+		default:
+			return fmt.Errorf("unknown task state %d", n)
+		}
+		return nil
+	}
+
+	var str string
+	err := json.Unmarshal(data, &str)
+	if err != nil {
+		return err
+	}
+	*s = TaskState(str)
+	return nil
+}
+
+// TaskStatus describes a task supervisor runs
+type TaskStatus struct {
+	ID           string    `json:"id"`
+	State        TaskState `json:"state"`
+	Terminal     string    `json:"terminal"`
+	Presentation struct {
+		Name string `json:"name"`
+	} `json:"presentation"`
+}
+
+// Tasks returns the current status of all tasks
+func (c *Client) Tasks(ctx context.Context) ([]TaskStatus, error) {
+	var res []TaskStatus
+	err := c.stream(ctx, "/status/tasks", func(msg json.RawMessage) error {
+		var status struct {
+			Tasks []TaskStatus `json:"tasks"`
+		}
+		err := json.Unmarshal(msg, &status)
+		if err != nil {
+			return err
+		}
+		res = status.Tasks
+		return errStreamDone
+	})
+	if err != nil && !errors.Is(err, errStreamDone) {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ObserveTasks calls onUpdate whenever the task status changes. It returns when the context is canceled
+// or the connection to supervisor breaks.
+func (c *Client) ObserveTasks(ctx context.Context, onUpdate func([]TaskStatus)) error {
+	return c.stream(ctx, "/status/tasks/observe/true", func(msg json.RawMessage) error {
+		var res struct {
+			Tasks []TaskStatus `json:"tasks"`
+		}
+		err := json.Unmarshal(msg, &res)
+		if err != nil {
+			return err
+		}
+		onUpdate(res.Tasks)
+		return nil
+	})
+}
+
+// PortStatus describes a port in the workspace
+type PortStatus struct {
+	LocalPort int  `json:"localPort"`
+	Served    bool `json:"served"`
+}
+
+// ObservePorts calls onUpdate whenever the port status changes. It returns when the context is canceled
+// or the connection to supervisor breaks.
+func (c *Client) ObservePorts(ctx context.Context, onUpdate func([]PortStatus)) error {
+	return c.stream(ctx, "/status/ports/observe/true", func(msg json.RawMessage) error {
+		var res struct {
+			Ports []struct {
+				PortStatus
+				// supervisor may be configured to use the proto field names
+				LocalPortOrig int `json:"local_port"`
+			} `json:"ports"`
+		}
+		err := json.Unmarshal(msg, &res)
+		if err != nil {
+			return err
+		}
+
+		ports := make([]PortStatus, 0, len(res.Ports))
+		for _, p := range res.Ports {
+			if p.LocalPort == 0 {
+				p.LocalPort = p.LocalPortOrig
+			}
+			ports = append(ports, p.PortStatus)
+		}
+		onUpdate(ports)
+		return nil
+	})
+}
+
+func (c *Client) url(ctx context.Context, path string) (string, error) {
+	addr, err := c.endpoint(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "http://" + addr + APIPrefix + path, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	u, err := c.url(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, string(msg))
+	}
+	return resp, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, res interface{}) error {
+	resp, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// stream reads a server-side stream. Each message arrives as a {"result": ...} object.
+func (c *Client) stream(ctx context.Context, path string, onMsg func(json.RawMessage) error) error {
+	resp, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg struct {
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		err := json.Unmarshal(scanner.Bytes(), &msg)
+		if err != nil {
+			return fmt.Errorf("cannot parse message from %s: %w", path, err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %s", path, msg.Error.Message)
+		}
+		err = onMsg(msg.Result)
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// Retry calls f until it succeeds or the context is canceled
+func Retry(ctx context.Context, interval time.Duration, f func() error) error {
+	for {
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
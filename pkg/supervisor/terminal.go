@@ -0,0 +1,93 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+var errStreamDone = errors.New("stream done")
+
+// ListenTerminal copies the output of a terminal to out until the terminal exits.
+// It returns the exit code of the terminal's process.
+func (c *Client) ListenTerminal(ctx context.Context, alias string, out io.Writer) (exitCode int, err error) {
+	err = c.stream(ctx, "/terminal/listen/"+url.PathEscape(alias), func(msg json.RawMessage) error {
+		var res struct {
+			Data     *string `json:"data"`
+			ExitCode *int    `json:"exitCode"`
+			// supervisor may be configured to use the proto field names
+			ExitCodeOrig *int `json:"exit_code"`
+		}
+		err := json.Unmarshal(msg, &res)
+		if err != nil {
+			return err
+		}
+
+		if res.ExitCode == nil {
+			res.ExitCode = res.ExitCodeOrig
+		}
+		if res.ExitCode != nil {
+			exitCode = *res.ExitCode
+			return errStreamDone
+		}
+		if res.Data == nil {
+			return nil
+		}
+
+		data, err := base64.StdEncoding.DecodeString(*res.Data)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	})
+	if errors.Is(err, errStreamDone) {
+		return exitCode, nil
+	}
+	return 0, err
+}
+
+// WriteTerminal writes to the stdin of a terminal
+func (c *Client) WriteTerminal(ctx context.Context, alias string, data []byte) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"stdin": base64.StdEncoding.EncodeToString(data),
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/terminal/write/"+url.PathEscape(alias), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SetTerminalSize resizes a terminal
+func (c *Client) SetTerminalSize(ctx context.Context, alias string, cols, rows int) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"size": map[string]int{
+			"cols": cols,
+			"rows": rows,
+		},
+		"force": true,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/terminal/size/"+url.PathEscape(alias), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -128,10 +128,14 @@ func defaultProperties() segment.Properties {
 		Set("version", opts.Version)
 }
 
-// GetGitRemoteOriginURI returns the remote origin URI for the specified working directory.
+// GetGitRemoteOriginURI returns the remote origin URI for the specified working directory,
+// or an empty string if there is none.
 func GetGitRemoteOriginURI(wd string) string {
-	git := exec.Command("git", "remote", "get-uri", "origin")
+	git := exec.Command("git", "remote", "get-url", "origin")
 	git.Dir = wd
-	gitout, _ := git.CombinedOutput()
+	gitout, err := git.Output()
+	if err != nil {
+		return ""
+	}
 	return strings.TrimSpace(string(gitout))
 }
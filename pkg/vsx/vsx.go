@@ -0,0 +1,315 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package vsx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRegistryURL is the registry extensions are downloaded from unless configured otherwise
+	DefaultRegistryURL = "https://open-vsx.org"
+
+	// CacheMount is where the extension cache is mounted in the workspace
+	CacheMount = "/.rungp-extensions"
+
+	// ExtensionsDir is where VS Code keeps the extensions in the workspace
+	ExtensionsDir = "/workspace/.vscode-remote/extensions"
+)
+
+// DefaultCacheDir returns the directory extensions are downloaded to. The cache is shared by all workspaces.
+func DefaultCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "run-gp", "extensions"), nil
+}
+
+// Extension identifies an extension as publisher.name, optionally pinned to a version, or a local .vsix file
+type Extension struct {
+	Publisher string
+	Name      string
+	// Version pins the extension to a version. Defaults to the latest version.
+	Version string
+
+	// Path is a .vsix file relative to the working copy. If set, the extension does not come from the registry.
+	Path string
+}
+
+// Parse parses an extension as found in the vscode section of the .gitpod.yml, i.e. publisher.name,
+// publisher.name@version or the path of a .vsix file relative to the working copy.
+func Parse(id string) (Extension, error) {
+	id = strings.TrimSpace(id)
+	if strings.HasSuffix(strings.ToLower(id), ".vsix") {
+		fn := path.Clean(filepath.ToSlash(id))
+		if path.IsAbs(fn) || filepath.IsAbs(id) || fn == ".." || strings.HasPrefix(fn, "../") {
+			return Extension{}, fmt.Errorf("invalid extension %q: .vsix files must be within the working copy", id)
+		}
+		return Extension{Path: fn}, nil
+	}
+
+	var version string
+	if i := strings.LastIndex(id, "@"); i >= 0 {
+		id, version = id[:i], id[i+1:]
+		if version == "" {
+			return Extension{}, fmt.Errorf("invalid extension %q: version is empty", id+"@")
+		}
+	}
+	segs := strings.Split(id, ".")
+	if len(segs) != 2 || segs[0] == "" || segs[1] == "" {
+		return Extension{}, fmt.Errorf("invalid extension %q: must be publisher.name, publisher.name@version or a .vsix file", id)
+	}
+	ext := Extension{Publisher: segs[0], Name: segs[1], Version: version}
+	err := ext.validate()
+	if err != nil {
+		return Extension{}, err
+	}
+	return ext, nil
+}
+
+// validPart matches the publisher, name and version of an extension. They end up in the file names of the cache.
+var validPart = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func (e Extension) validate() error {
+	for _, p := range []struct {
+		Kind  string
+		Value string
+	}{
+		{"publisher", e.Publisher},
+		{"name", e.Name},
+		{"version", e.Version},
+	} {
+		if p.Value == "" && p.Kind == "version" {
+			continue
+		}
+		if !validPart.MatchString(p.Value) {
+			return fmt.Errorf("invalid extension %s: %s %q contains invalid characters", e, p.Kind, p.Value)
+		}
+	}
+	return nil
+}
+
+// ID returns publisher.name, or the file name of a local .vsix file
+func (e Extension) ID() string {
+	if e.Path != "" {
+		return path.Base(e.Path)
+	}
+	return e.Publisher + "." + e.Name
+}
+
+func (e Extension) String() string {
+	switch {
+	case e.Path != "":
+		return e.Path
+	case e.Version != "":
+		return e.ID() + "@" + e.Version
+	default:
+		return e.ID()
+	}
+}
+
+// Registry is an Open VSX compatible extension registry
+type Registry struct {
+	// URL of the registry. Defaults to DefaultRegistryURL.
+	URL string
+}
+
+// BaseURL returns the URL of the registry without trailing slash
+func (r Registry) BaseURL() string {
+	if r.URL == "" {
+		return DefaultRegistryURL
+	}
+	return strings.TrimSuffix(r.URL, "/")
+}
+
+// client gives up quickly if the registry is unreachable, e.g. because we're offline, so that Fetch can fall back
+// to the cache without holding up the workspace start. Downloads themselves are not limited in time.
+var client = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	},
+}
+
+// Release is a downloadable version of an extension
+type Release struct {
+	Version string
+	URL     string
+}
+
+// Release asks the registry for the version of an extension it is pinned to, or its latest version
+func (r Registry) Release(ctx context.Context, ext Extension) (*Release, error) {
+	if ext.Path != "" {
+		return nil, fmt.Errorf("%s is a local extension", ext)
+	}
+
+	u := fmt.Sprintf("%s/api/%s/%s", r.BaseURL(), url.PathEscape(ext.Publisher), url.PathEscape(ext.Name))
+	if ext.Version != "" {
+		u += "/" + url.PathEscape(ext.Version)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("extension %s not found in %s", ext, r.BaseURL())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot discover release of %s: %s", ext, resp.Status)
+	}
+
+	var rel struct {
+		Version string `json:"version"`
+		Files   struct {
+			Download string `json:"download"`
+		} `json:"files"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&rel)
+	if err != nil {
+		return nil, err
+	}
+	if rel.Version == "" || rel.Files.Download == "" {
+		return nil, fmt.Errorf("registry %s returned no download for %s", r.BaseURL(), ext)
+	}
+	if !validPart.MatchString(rel.Version) {
+		return nil, fmt.Errorf("registry %s returned invalid version %q for %s", r.BaseURL(), rel.Version, ext)
+	}
+	return &Release{Version: rel.Version, URL: rel.Files.Download}, nil
+}
+
+// Fetch makes sure an extension is available in the cache directory and returns the .vsix file.
+// Extensions are downloaded only once. Unless the extension is pinned to a version, Fetch looks for its latest
+// version. If that cannot be discovered, e.g. because we're offline, the most recently downloaded version in the
+// cache is used.
+func Fetch(ctx context.Context, cacheDir string, reg Registry, ext Extension) (fn string, err error) {
+	if ext.Path != "" {
+		return "", fmt.Errorf("%s is a local extension", ext)
+	}
+	err = ext.validate()
+	if err != nil {
+		return "", err
+	}
+	if ext.Version != "" {
+		fn = cacheFile(cacheDir, ext.ID(), ext.Version)
+		if _, err := os.Stat(fn); err == nil {
+			return fn, nil
+		}
+	}
+
+	rel, err := reg.Release(ctx, ext)
+	if err != nil {
+		if ext.Version != "" {
+			return "", err
+		}
+		if cached := newestCached(cacheDir, ext); cached != "" {
+			return cached, nil
+		}
+		return "", err
+	}
+
+	fn = cacheFile(cacheDir, ext.ID(), rel.Version)
+	if _, err := os.Stat(fn); err == nil {
+		return fn, nil
+	}
+	err = download(ctx, rel.URL, fn)
+	if err != nil {
+		return "", err
+	}
+	return fn, nil
+}
+
+func cacheFile(cacheDir, id, version string) string {
+	return filepath.Join(cacheDir, fmt.Sprintf("%s-%s.vsix", id, version))
+}
+
+// newestCached returns the most recently downloaded version of an extension, or an empty string if there is none
+func newestCached(cacheDir string, ext Extension) string {
+	cached, _ := filepath.Glob(filepath.Join(cacheDir, ext.ID()+"-*.vsix"))
+	var (
+		res    string
+		newest int64
+	)
+	for _, fn := range cached {
+		// foo.bar-* also matches the extension foo.bar-baz
+		version := strings.TrimPrefix(filepath.Base(fn), ext.ID()+"-")
+		if version == "" || version[0] < '0' || version[0] > '9' {
+			continue
+		}
+		stat, err := os.Stat(fn)
+		if err != nil {
+			continue
+		}
+		if mt := stat.ModTime().UnixNano(); res == "" || mt > newest {
+			res, newest = fn, mt
+		}
+	}
+	return res
+}
+
+// download downloads a file such that dst either is complete or does not exist
+func download(ctx context.Context, u, dst string) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot download %s: %s", u, resp.Status)
+	}
+
+	tmp := dst + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %s: %w", u, err)
+	}
+	return os.Rename(tmp, dst)
+}
+
+// CachedFile returns the location of a file in the extension cache in the workspace
+func CachedFile(fn string) string {
+	return path.Join(CacheMount, filepath.Base(fn))
+}
+
+// InstallCommand installs an extension into the embedded VS Code of a workspace. fn is the .vsix file in the workspace.
+func InstallCommand(fn string) []string {
+	return []string{"/ide/bin/gitpod-code", "--extensions-dir", ExtensionsDir, "--install-extension", fn}
+}